@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+)
+
+// AccountGate bounds how many requests may be in flight
+// for any single account. the FOR NO KEY UPDATE lock already
+// serializes writes, but every request waiting on that lock
+// is also sitting on a pooled connection, so a hot account
+// can starve everyone else of connections. the gate rejects
+// the excess before they ever reach the pool.
+type AccountGate struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight map[uint64]int
+}
+
+var accountGate *AccountGate
+
+// NewAccountGate returns a gate admitting up to limit
+// concurrent requests per account, a limit of zero or
+// less admits everything.
+func NewAccountGate(limit int) *AccountGate {
+	return &AccountGate{
+		limit:    limit,
+		inFlight: make(map[uint64]int),
+	}
+}
+
+// TryAcquire reserves a slot for the account, returning
+// false without blocking if the account is at its limit.
+// every successful acquire must be paired with a Release.
+func (g *AccountGate) TryAcquire(accountID uint64) bool {
+	if g.limit <= 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.inFlight[accountID] >= g.limit {
+		return false
+	}
+	g.inFlight[accountID]++
+
+	return true
+}
+
+func (g *AccountGate) Release(accountID uint64) {
+	if g.limit <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.inFlight[accountID]--
+	// don't let the map grow with every account ever seen
+	if g.inFlight[accountID] <= 0 {
+		delete(g.inFlight, accountID)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signAdminRequest signs the request as verifyAdminRequestSignature
+// expects, over the given query rather than the request's own.
+func signAdminRequest(r *http.Request, query string, body string, signedAt time.Time, nonce string) {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(config.AdminSigningKey))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n", r.Method, r.URL.Path, query, timestamp, nonce)
+	mac.Write([]byte(body))
+
+	r.Header.Set(adminTimestampHeader, timestamp)
+	r.Header.Set(adminNonceHeader, nonce)
+	r.Header.Set(adminSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyAdminRequestSignature(t *testing.T) {
+	defer func(signingKey string, replayWindow time.Duration) {
+		config.AdminSigningKey = signingKey
+		config.AdminReplayWindow = replayWindow
+	}(config.AdminSigningKey, config.AdminReplayWindow)
+	config.AdminSigningKey = "signing-key"
+	config.AdminReplayWindow = 5 * time.Minute
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	body := `{"account_id":1}`
+
+	tests := []struct {
+		name        string
+		target      string
+		signedQuery string
+		signedBody  string
+		signedAt    time.Time
+		valid       bool
+	}{
+		{name: "signed", target: "/admin/set_balance", signedBody: body, signedAt: now, valid: true},
+		{name: "signed with query", target: "/admin/set_balance?tenant=a&force=true", signedQuery: "force=true&tenant=a", signedBody: body, signedAt: now, valid: true},
+		{name: "query not signed", target: "/admin/set_balance?tenant=a", signedBody: body, signedAt: now},
+		{name: "query changed", target: "/admin/set_balance?tenant=b", signedQuery: "tenant=a", signedBody: body, signedAt: now},
+		{name: "body changed", target: "/admin/set_balance", signedBody: `{"account_id":2}`, signedAt: now},
+		{name: "edge of the replay window", target: "/admin/set_balance", signedBody: body, signedAt: now.Add(-5 * time.Minute), valid: true},
+		{name: "outside the replay window", target: "/admin/set_balance", signedBody: body, signedAt: now.Add(-5*time.Minute - time.Second)},
+		{name: "from the future", target: "/admin/set_balance", signedBody: body, signedAt: now.Add(5*time.Minute + time.Second)},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+			signAdminRequest(r, tt.signedQuery, tt.signedBody, tt.signedAt, fmt.Sprintf("nonce-%d", i))
+
+			err := verifyAdminRequestSignature(r, now)
+			if tt.valid && err != nil {
+				t.Fatalf("expected the request to verify, got %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected the request to be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyAdminRequestSignatureReplay(t *testing.T) {
+	defer func(signingKey string, replayWindow time.Duration) {
+		config.AdminSigningKey = signingKey
+		config.AdminReplayWindow = replayWindow
+	}(config.AdminSigningKey, config.AdminReplayWindow)
+	config.AdminSigningKey = "signing-key"
+	config.AdminReplayWindow = 5 * time.Minute
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for i, expectValid := range []bool{true, false} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/set_balance", strings.NewReader("{}"))
+		signAdminRequest(r, "", "{}", now, "replayed-nonce")
+
+		err := verifyAdminRequestSignature(r, now)
+		if expectValid && err != nil {
+			t.Fatalf("request %d: expected the request to verify, got %s", i, err)
+		}
+		if !expectValid && err == nil {
+			t.Fatalf("request %d: expected the replayed request to be rejected", i)
+		}
+	}
+}
+
+func TestVerifyAdminRequestSignaturePreservesBody(t *testing.T) {
+	defer func(signingKey string) {
+		config.AdminSigningKey = signingKey
+	}(config.AdminSigningKey)
+	config.AdminSigningKey = "signing-key"
+
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodPost, "/admin/set_balance", strings.NewReader(`{"account_id":1}`))
+	signAdminRequest(r, "", `{"account_id":1}`, now, fmt.Sprintf("body-nonce-%d", now.UnixNano()))
+	if err := verifyAdminRequestSignature(r, now); err != nil {
+		t.Fatalf("expected the request to verify, got %s", err)
+	}
+
+	var req struct {
+		AccountID uint64 `json:"account_id"`
+	}
+	if err := decodeRequestBody(r.Body, &req); err != nil || req.AccountID != 1 {
+		t.Errorf("expected the body to be readable after verifying, got %+v, %v", req, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const defaultAmountUnit = "cents"
+
+// the units requests can express amounts in, by how many of
+// the unit make up a cent. amounts are always stored in cents.
+var amountUnitsPerCent = map[string]int64{
+	"cents": 1,
+	// tenths of a cent, as fuel and utility rates are quoted in
+	"mills": 10,
+	// millionths of a dollar
+	"micros": 10000,
+}
+
+var ErrUnknownAmountUnit = errors.New("error unknown amount_unit")
+
+// amountInCents converts an amount in the given unit to cents,
+// failing rather than rounding when it isn't a whole number of cents.
+func amountInCents(amount int64, unit string) (int64, error) {
+	if unit == "" {
+		unit = defaultAmountUnit
+	}
+
+	unitsPerCent, ok := amountUnitsPerCent[unit]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownAmountUnit, unit)
+	}
+	if amount%unitsPerCent != 0 {
+		return 0, fmt.Errorf("error amount %d %s isn't a whole number of cents", amount, unit)
+	}
+
+	return amount / unitsPerCent, nil
+}
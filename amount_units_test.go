@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAmountInCents(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		unit     string
+		expected int64
+		wantErr  bool
+	}{
+		{name: "default unit", amount: 150, unit: "", expected: 150},
+		{name: "cents", amount: 150, unit: "cents", expected: 150},
+		{name: "mills", amount: 1500, unit: "mills", expected: 150},
+		{name: "mills not a whole cent", amount: 1505, unit: "mills", wantErr: true},
+		{name: "micros", amount: 1500000, unit: "micros", expected: 150},
+		{name: "micros not a whole cent", amount: 1500001, unit: "micros", wantErr: true},
+		{name: "less than a cent", amount: 9, unit: "mills", wantErr: true},
+		{name: "unknown unit", amount: 150, unit: "dollars", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cents, err := amountInCents(tt.amount, tt.unit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d cents", cents)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if cents != tt.expected {
+				t.Errorf("expected %d cents, got %d", tt.expected, cents)
+			}
+		})
+	}
+}
+
+func TestAmountInCentsUnknownUnit(t *testing.T) {
+	if _, err := amountInCents(1, "dollars"); !errors.Is(err, ErrUnknownAmountUnit) {
+		t.Errorf("expected ErrUnknownAmountUnit, got %v", err)
+	}
+}
+
+func TestConvertAmountsToCents(t *testing.T) {
+	req := executeOperationsRequest{
+		AmountUnit: "mills",
+		Operations: []operationRequest{op("CREDIT", 1000), op("DEBIT", 250)},
+	}
+	if err := req.ConvertAmountsToCents(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if req.Operations[0].AmountInCents != 100 || req.Operations[1].AmountInCents != 25 {
+		t.Errorf("expected amounts of 100 and 25 cents, got %d and %d", req.Operations[0].AmountInCents, req.Operations[1].AmountInCents)
+	}
+	// so the request isn't converted twice
+	if req.AmountUnit != "" {
+		t.Errorf("expected the amount unit to be cleared, got %q", req.AmountUnit)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+const maxBatchCreateAccounts = 1000
+
+type batchCreateAccountsRequest struct {
+	UserARIs []string `json:"user_aris"`
+}
+
+type batchCreateAccountsResponse struct {
+	Accounts []Account `json:"accounts"`
+}
+
+// HandleBatchCreateAccountsWithContext creates an account for each of the
+// user ARIs in a single insert, so onboarding many users doesn't take a
+// request and a database transaction each. either all are created or none.
+func HandleBatchCreateAccountsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received batch create accounts request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req batchCreateAccountsRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if len(req.UserARIs) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if len(req.UserARIs) > maxBatchCreateAccounts {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error too many accounts, at most %d allowed per batch", maxBatchCreateAccounts))
+		return
+	}
+	seen := make(map[string]bool, len(req.UserARIs))
+	for i := range req.UserARIs {
+		if req.UserARIs[i] == "" {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+			return
+		}
+		if seen[req.UserARIs[i]] {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error duplicate user_ari %q in batch", req.UserARIs[i]))
+			return
+		}
+		seen[req.UserARIs[i]] = true
+	}
+
+	// each account is charged against the same limits as if it had
+	// been created on its own, a batch is no way around them
+	for _, limiter := range []*RateLimiter{createAccountIPLimiter, createAccountLimiter} {
+		if limiter.Limit() > 0 && len(req.UserARIs) > limiter.Limit() {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error too many accounts, at most %d can be created per minute", limiter.Limit()))
+			return
+		}
+	}
+	if allowed, retryAfter := createAccountIPLimiter.AllowN(sourceIP(r), len(req.UserARIs)); !allowed {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, retryAfter, fmt.Errorf("error too many accounts created from this address"))
+		return
+	}
+	if allowed, retryAfter := createAccountLimiter.AllowN("", len(req.UserARIs)); !allowed {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, retryAfter, fmt.Errorf("error too many accounts created"))
+		return
+	}
+
+	logger.Infow("handling batch create accounts request", "request", redacted(req))
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Errorf("error beginning batch create accounts transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	accounts, err := BatchCreateAccountsWithContext(ctx, tx, req.UserARIs)
+	if errors.Is(err, ErrAccountAlreadyExists) {
+		writeHTTPError(w, http.StatusConflict, ErrAccountAlreadyExists)
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing batch create accounts database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing batch create accounts database state: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(batchCreateAccountsResponse{Accounts: accounts})
+	if err != nil {
+		logger.Errorf("error marshaling batch create accounts response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("accounts created", "count", len(accounts))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
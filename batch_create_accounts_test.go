@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleBatchCreateAccountsRateLimited(t *testing.T) {
+	defer func(limiter, ipLimiter *RateLimiter) {
+		createAccountLimiter, createAccountIPLimiter = limiter, ipLimiter
+	}(createAccountLimiter, createAccountIPLimiter)
+
+	tests := []struct {
+		name       string
+		perMinute  int
+		perIP      int
+		body       string
+		statusCode int
+	}{
+		{name: "batch larger than the limit", perMinute: 2, body: `{"user_aris":["a","b","c"]}`, statusCode: http.StatusBadRequest},
+		{name: "batch larger than the per ip limit", perIP: 2, body: `{"user_aris":["a","b","c"]}`, statusCode: http.StatusBadRequest},
+		{name: "limit used up", perMinute: 3, body: `{"user_aris":["a","b","c"]}`, statusCode: http.StatusTooManyRequests},
+		{name: "per ip limit used up", perIP: 3, body: `{"user_aris":["a","b","c"]}`, statusCode: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAccountLimiter = NewRateLimiter(tt.perMinute)
+			createAccountIPLimiter = NewRateLimiter(tt.perIP)
+			// uses up the limits, as a previous batch would have
+			createAccountLimiter.AllowN("", tt.perMinute)
+			createAccountIPLimiter.AllowN("192.0.2.1", tt.perIP)
+
+			r := httptest.NewRequest(http.MethodPost, "/batch_create_accounts", strings.NewReader(tt.body))
+			r.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			// rejected before the pool is used
+			HandleBatchCreateAccountsWithContext(context.Background(), nil, w, r)
+
+			if w.Code != tt.statusCode {
+				t.Errorf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("expected a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestHandleBatchCreateAccountsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "no user_aris", body: `{"user_aris":[]}`},
+		{name: "empty user_ari", body: `{"user_aris":["a",""]}`},
+		{name: "user_ari repeated in the batch", body: `{"user_aris":["a","b","a"]}`},
+		{name: "too many user_aris", body: `{"user_aris":["` + strings.Repeat(`a","`, maxBatchCreateAccounts) + `a"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/batch_create_accounts", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			// rejected before the pool is used
+			HandleBatchCreateAccountsWithContext(context.Background(), nil, w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
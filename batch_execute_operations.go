@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+)
+
+const (
+	maxBatchExecuteRequests = 100
+
+	// a failure anywhere rolls back the whole batch
+	batchModeAllOrNothing = "all_or_nothing"
+	// a failure only rolls back the failed request
+	batchModeSavepoint = "savepoint"
+)
+
+type batchExecuteOperationsRequest struct {
+	Mode     string                     `json:"mode"`
+	Requests []executeOperationsRequest `json:"requests"`
+}
+
+type batchExecuteOperationsResult struct {
+	Succeeded bool `json:"succeeded"`
+	executeOperationsResponse
+}
+
+type batchExecuteOperationsResponse struct {
+	Mode    string                         `json:"mode"`
+	Results []batchExecuteOperationsResult `json:"results"`
+}
+
+// HandleBatchExecuteOperationsWithContext plays operations against multiple
+// accounts in a single database transaction. in savepoint mode, each request
+// runs under its own SAVEPOINT so that a failing request is rolled back on its
+// own while the rest still commit, without paying for a transaction per account.
+func HandleBatchExecuteOperationsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received batch execute operations request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req batchExecuteOperationsRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = batchModeAllOrNothing
+	}
+	if req.Mode != batchModeAllOrNothing && req.Mode != batchModeSavepoint {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid mode"))
+		return
+	}
+	if len(req.Requests) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if len(req.Requests) > maxBatchExecuteRequests {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error too many requests, at most %d allowed per batch", maxBatchExecuteRequests))
+		return
+	}
+	for i := range req.Requests {
+		if err := req.Requests[i].ConvertAmountsToCents(); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid request %d: %w", i, err))
+			return
+		}
+		if err := req.Requests[i].Validate(); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid request %d: %w", i, err))
+			return
+		}
+		if req.Requests[i].IdempotencyKey != "" {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid request %d: idempotency_key isn't supported in batches", i))
+			return
+		}
+		if req.Requests[i].DryRun {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid request %d: dry_run isn't supported in batches", i))
+			return
+		}
+	}
+
+	// account locks are always taken in the same order, so
+	// two batches sharing accounts can't deadlock each other.
+	// results are still reported in the order requested.
+	order := make([]int, len(req.Requests))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return req.Requests[order[i]].AccountID < req.Requests[order[j]].AccountID
+	})
+
+	// the gate of every account in the batch is held across
+	// attempts, an account played twice only takes it once
+	var gatedAccountIDs []uint64
+	defer func() {
+		for _, accountID := range gatedAccountIDs {
+			accountGate.Release(accountID)
+		}
+	}()
+	for _, i := range order {
+		accountID := req.Requests[i].AccountID
+		if len(gatedAccountIDs) > 0 && gatedAccountIDs[len(gatedAccountIDs)-1] == accountID {
+			continue
+		}
+		if !accountGate.TryAcquire(accountID) {
+			writeRetryableHTTPError(w, http.StatusTooManyRequests, config.ConcurrencyRetryAfter, fmt.Errorf("error too many concurrent requests for account"))
+			return
+		}
+		gatedAccountIDs = append(gatedAccountIDs, accountID)
+	}
+
+	logger.Infow("handling batch execute operations request", "request", redacted(req))
+	var results []batchExecuteOperationsResult
+	err := withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		var err error
+		results, err = executeBatchInTx(ctx, tx, req, order)
+		return err
+	})
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if errors.Is(err, ErrConcurrentModification) {
+		logger.Warnw("giving up on concurrently modified account", "request", redacted(req), "error", err.Error())
+		writeHTTPError(w, http.StatusConflict, ErrConcurrentModification)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing batch execute operations request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("batch operations executed", "request", redacted(req), "results", redacted(results))
+	for i := range req.Requests {
+		if results[i].Succeeded {
+			observeOperationAmounts(req.Requests[i].Operations)
+		}
+	}
+
+	marshaledData, err := json.Marshal(batchExecuteOperationsResponse{Mode: req.Mode, Results: results})
+	if err != nil {
+		logger.Errorf("error marshaling response for batch execute operations request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// executeBatchInTx plays the batch's requests in the given order. a
+// request rejected for what it played is reported in its result, in
+// all_or_nothing mode failing the batch with the earlyResponse to
+// write. any other error fails the batch, to be retried or reported
+// as the failure it is rather than blamed on the request.
+func executeBatchInTx(ctx context.Context, tx *sql.Tx, req batchExecuteOperationsRequest, order []int) ([]batchExecuteOperationsResult, error) {
+	results := make([]batchExecuteOperationsResult, len(req.Requests))
+	for _, i := range order {
+		savepoint := fmt.Sprintf("batch_request_%d", i)
+		if req.Mode == batchModeSavepoint {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+				return nil, fmt.Errorf("error creating savepoint: %w", err)
+			}
+		}
+
+		result, err := executeOperationsInTransaction(ctx, tx, req.Requests[i])
+		if err == nil {
+			results[i] = batchExecuteOperationsResult{Succeeded: true, executeOperationsResponse: result}
+			continue
+		}
+		if !isPlayRejection(err) {
+			return nil, fmt.Errorf("error executing request %d: %w", i, err)
+		}
+
+		logger.Infow("batch request failed", "request", redacted(req.Requests[i]), "error", err)
+		results[i] = batchExecuteOperationsResult{executeOperationsResponse: executeOperationsResponse{Error: err.Error(), Code: errorCode(config.BusinessRejectionStatus, err)}}
+		if req.Mode == batchModeAllOrNothing {
+			marshaledData, marshalErr := json.Marshal(batchExecuteOperationsResponse{Mode: req.Mode, Results: results})
+			if marshalErr != nil {
+				return nil, fmt.Errorf("error marshaling response: %w", marshalErr)
+			}
+
+			return nil, earlyResponse{statusCode: config.BusinessRejectionStatus, body: marshaledData, cause: err}
+		}
+
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); err != nil {
+			return nil, fmt.Errorf("error rolling back to savepoint: %w", err)
+		}
+	}
+
+	return results, nil
+}
+
+// isPlayRejection reports whether err rejected a request for what it
+// asked to play, rather than failing it for reasons of the server's.
+func isPlayRejection(err error) bool {
+	for _, rejection := range []error{
+		ErrNotFound,
+		ErrInvalidPlayOrderNegativeBalance,
+		ErrInvalidPlayOrderNegativeHold,
+		ErrAmountOverflow,
+		ErrTooManyActiveHolds,
+		ErrAccountOperationLimit,
+		ErrTransactionOperationLimit,
+		ErrTransactionAccountMismatch,
+		ErrTransactionClosed,
+		ErrAccountClosed,
+	} {
+		if errors.Is(err, rejection) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// executeOperationsInTransaction reads the account and plays the
+// request's operations within the given database transaction.
+func executeOperationsInTransaction(ctx context.Context, tx *sql.Tx, req executeOperationsRequest) (executeOperationsResponse, error) {
+	operations, err := operationsFromRequest(req)
+	if err != nil {
+		return executeOperationsResponse{}, err
+	}
+	operations, err = operationsWithFees(req.Tenant, operations)
+	if err != nil {
+		return executeOperationsResponse{}, err
+	}
+
+	// optimistically, the account is only checked
+	// to be unchanged when it's updated, see UpdateAccountWithContext
+	readAccountWithContext := LockAccountWithContext
+	if config.OptimisticAccountLocking {
+		readAccountWithContext = GetAccountWithContext
+	}
+	account, err := readAccountWithContext(ctx, tx, req.AccountID)
+	if errors.Is(err, ErrNotFound) {
+		return executeOperationsResponse{}, fmt.Errorf("error account %w", ErrNotFound)
+	}
+	if err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error reading account: %w", err)
+	}
+
+	if req.TransactionID == 0 {
+		return processNewTransaction(ctx, tx, req.Tenant, operations, account)
+	}
+
+	transaction, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
+	if errors.Is(err, ErrNotFound) {
+		return executeOperationsResponse{}, fmt.Errorf("error transaction %w", ErrNotFound)
+	}
+	if err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error getting transaction: %w", err)
+	}
+
+	return processExistingTransaction(ctx, tx, operations, account, transaction)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestIsPlayRejection(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		rejected bool
+	}{
+		{name: "negative balance", err: ErrInvalidPlayOrderNegativeBalance, rejected: true},
+		{name: "wrapped negative hold", err: fmt.Errorf("error processing operations: %w", ErrInvalidPlayOrderNegativeHold), rejected: true},
+		{name: "amount overflow", err: ErrAmountOverflow, rejected: true},
+		{name: "too many active holds", err: ErrTooManyActiveHolds, rejected: true},
+		{name: "account not found", err: fmt.Errorf("error account %w", ErrNotFound), rejected: true},
+		{name: "transaction operation limit", err: ErrTransactionOperationLimit, rejected: true},
+		{name: "account operation limit", err: ErrAccountOperationLimit, rejected: true},
+		{name: "account closed", err: ErrAccountClosed, rejected: true},
+		{name: "transaction closed", err: ErrTransactionClosed, rejected: true},
+		{name: "concurrent modification", err: ErrConcurrentModification},
+		{name: "duplicate sequence", err: fmt.Errorf("%w: duplicate key", ErrDuplicateSequence)},
+		{name: "timed out", err: fmt.Errorf("error reading account: %w", context.DeadlineExceeded)},
+		{name: "database error", err: errors.New("error executing query: connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rejected := isPlayRejection(tt.err); rejected != tt.rejected {
+				t.Errorf("expected rejected %t, got %t", tt.rejected, rejected)
+			}
+		})
+	}
+}
+
+func TestHandleBatchExecuteOperationsMixedResults(t *testing.T) {
+	pool := testPool(t)
+
+	tests := []struct {
+		mode           string
+		statusCode     int
+		fundedBalance  int64
+		overdrawnPlays bool
+	}{
+		// the overdrawn request is rolled back on its own
+		{mode: batchModeSavepoint, statusCode: http.StatusOK, fundedBalance: 100},
+		// the overdrawn request rolls back the whole batch
+		{mode: batchModeAllOrNothing, statusCode: config.BusinessRejectionStatus, fundedBalance: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			funded := testAccount(t, pool)
+			overdrawn := testAccount(t, pool)
+
+			w := testRequest(t, HandleBatchExecuteOperationsWithContext, pool, http.MethodPost, "/batch_execute_operations", batchExecuteOperationsRequest{
+				Mode: tt.mode,
+				Requests: []executeOperationsRequest{
+					{AccountID: funded.AccountID, Tenant: testTenant, Operations: []operationRequest{op("CREDIT", 100)}},
+					{AccountID: overdrawn.AccountID, Tenant: testTenant, Operations: []operationRequest{op("DEBIT", 100)}},
+				},
+			})
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+
+			var res batchExecuteOperationsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if len(res.Results) != 2 {
+				t.Fatalf("expected 2 results, got %d", len(res.Results))
+			}
+			if tt.mode == batchModeSavepoint && !res.Results[0].Succeeded {
+				t.Errorf("expected the funded request to succeed, got %s", res.Results[0].Error)
+			}
+			if res.Results[1].Succeeded || res.Results[1].Code != errorCode(config.BusinessRejectionStatus, ErrInvalidPlayOrderNegativeBalance) {
+				t.Errorf("expected the overdrawn request to be rejected, got %+v", res.Results[1])
+			}
+
+			if balance := testGetAccount(t, pool, funded.AccountID).RunningBalance; balance != tt.fundedBalance {
+				t.Errorf("expected the funded account's balance to be %d, got %d", tt.fundedBalance, balance)
+			}
+			if balance := testGetAccount(t, pool, overdrawn.AccountID).RunningBalance; balance != 0 {
+				t.Errorf("expected the overdrawn account's balance to be 0, got %d", balance)
+			}
+		})
+	}
+}
+
+func TestHandleBatchExecuteOperationsMissingAccountIsRejected(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+
+	w := testRequest(t, HandleBatchExecuteOperationsWithContext, pool, http.MethodPost, "/batch_execute_operations", batchExecuteOperationsRequest{
+		Mode: batchModeSavepoint,
+		Requests: []executeOperationsRequest{
+			{AccountID: account.AccountID, Tenant: testTenant, Operations: []operationRequest{op("CREDIT", 100)}},
+			// no account has the largest id
+			{AccountID: 1<<63 - 1, Tenant: testTenant, Operations: []operationRequest{op("CREDIT", 100)}},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var res batchExecuteOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if !res.Results[0].Succeeded || res.Results[1].Succeeded || res.Results[1].Code != "NOT_FOUND" {
+		t.Errorf("expected only the missing account's request to be rejected, got %+v", res.Results)
+	}
+}
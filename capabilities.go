@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+)
+
+type capabilitiesResponse struct {
+	Version                         string           `json:"version"`
+	MaxOperationsPerRequest         int              `json:"max_operations_per_request"`
+	MaxOperationsPerTransactionRead int              `json:"max_operations_per_transaction_read"`
+	OperationTypes                  []string         `json:"operation_types"`
+	AmountUnits                     []string         `json:"amount_units"`
+	AllowedTenants                  []string         `json:"allowed_tenants"`
+	TimeoutsInMs                    map[string]int64 `json:"timeouts_in_ms"`
+}
+
+// HandleCapabilities describes the effective limits of the
+// server so clients can configure themselves against it.
+// it's built purely from config and never touches the database.
+// an empty list of allowed tenants means any tenant is allowed.
+func HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	allowedTenants := config.AllowedTenants
+	if allowedTenants == nil {
+		allowedTenants = []string{}
+	}
+
+	amountUnits := make([]string, 0, len(amountUnitsPerCent))
+	for unit := range amountUnitsPerCent {
+		amountUnits = append(amountUnits, unit)
+	}
+	sort.Strings(amountUnits)
+
+	result := capabilitiesResponse{
+		Version:                         version,
+		MaxOperationsPerRequest:         config.MaxOperationsPerRequest,
+		MaxOperationsPerTransactionRead: config.MaxOperationsPerTransactionRead,
+		OperationTypes:                  OperationTypes,
+		AmountUnits:                     amountUnits,
+		AllowedTenants:                  allowedTenants,
+		TimeoutsInMs: map[string]int64{
+			"create_account":     config.Timeouts.CreateAccount.Milliseconds(),
+			"execute_operations": config.Timeouts.ExecuteOperations.Milliseconds(),
+			"get":                config.Timeouts.Get.Milliseconds(),
+		},
+	}
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling capabilities response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,57 @@
+package main
+
+const (
+	eventsFormatNative = "native"
+	// a Debezium-like change envelope, for CDC pipelines
+	eventsFormatCDC = "cdc"
+)
+
+// cdcEnvelope wraps an event the way Debezium wraps a row
+// it captured being inserted. events are never updated or
+// deleted, so the op is always "c" and there's never a before.
+type cdcEnvelope struct {
+	Op     string    `json:"op"`
+	Before *Event    `json:"before"`
+	After  Event     `json:"after"`
+	Source cdcSource `json:"source"`
+	// when the envelope was produced, in ms since the epoch
+	TsMs int64 `json:"ts_ms"`
+}
+
+type cdcSource struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	Table     string `json:"table"`
+	// when the event was recorded, in ms since the epoch
+	TsMs int64 `json:"ts_ms"`
+	// the event's position in its account's log
+	Sequence int64 `json:"sequence"`
+	// see eventSchemaVersion
+	SchemaVersion int `json:"schema_version"`
+}
+
+// cdcEnvelopes wraps the events, produced as of nowMs.
+func cdcEnvelopes(events []Event, nowMs int64) []cdcEnvelope {
+	envelopes := make([]cdcEnvelope, len(events))
+	for i := range events {
+		envelopes[i] = cdcEnvelope{
+			Op:    "c",
+			After: events[i],
+			Source: cdcSource{
+				Version:   version,
+				Connector: "affount",
+				Name:      "affount",
+				Table:     "events",
+				TsMs:      events[i].Created.UnixNano() / 1e6,
+				Sequence:  events[i].Sequence,
+				// consumers can pick how to decode the
+				// event before decoding it
+				SchemaVersion: events[i].SchemaVersion,
+			},
+			TsMs: nowMs,
+		}
+	}
+
+	return envelopes
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+const (
+	// how many ids each page of the scan covers, keeping
+	// the anti-joins short enough to check for cancellation
+	// in between rather than scanning whole tables at once
+	orphanScanPageSize = 10000
+	// the most orphans of each kind a scan will report
+	maxOrphansReported = 1000
+)
+
+type checkOrphanedOperationsResponse struct {
+	OperationsWithoutEvents []Operation `json:"operations_without_events"`
+	EventsWithoutOperations []Event     `json:"events_without_operations"`
+	// set when there were more orphans than reported
+	Truncated bool `json:"truncated"`
+}
+
+// HandleCheckOrphanedOperationsWithContext scans for operations that never
+// produced an event, and for events whose operation doesn't exist. every
+// operation is played into exactly one event, so either means the event
+// trail no longer accounts for the running balances.
+func HandleCheckOrphanedOperationsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received check orphaned operations request")
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning check orphaned operations transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	maxOperationID, maxEventID, err := GetMaxOperationAndEventIDsWithContext(ctx, tx)
+	if err != nil {
+		writeOrphanScanError(w, err)
+		return
+	}
+
+	result := checkOrphanedOperationsResponse{OperationsWithoutEvents: []Operation{}, EventsWithoutOperations: []Event{}}
+	for from := uint64(0); from < maxOperationID; from += orphanScanPageSize {
+		if err := ctx.Err(); err != nil {
+			writeOrphanScanError(w, err)
+			return
+		}
+		operations, err := GetOperationsWithoutEventsWithContext(ctx, tx, from, from+orphanScanPageSize)
+		if err != nil {
+			writeOrphanScanError(w, err)
+			return
+		}
+		result.OperationsWithoutEvents = append(result.OperationsWithoutEvents, operations...)
+		if len(result.OperationsWithoutEvents) > maxOrphansReported {
+			result.OperationsWithoutEvents = result.OperationsWithoutEvents[:maxOrphansReported]
+			result.Truncated = true
+			break
+		}
+	}
+
+	for from := uint64(0); from < maxEventID; from += orphanScanPageSize {
+		if err := ctx.Err(); err != nil {
+			writeOrphanScanError(w, err)
+			return
+		}
+		events, err := GetEventsWithoutOperationsWithContext(ctx, tx, from, from+orphanScanPageSize)
+		if err != nil {
+			writeOrphanScanError(w, err)
+			return
+		}
+		result.EventsWithoutOperations = append(result.EventsWithoutOperations, events...)
+		if len(result.EventsWithoutOperations) > maxOrphansReported {
+			result.EventsWithoutOperations = result.EventsWithoutOperations[:maxOrphansReported]
+			result.Truncated = true
+			break
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing check orphaned operations transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if len(result.OperationsWithoutEvents) > 0 || len(result.EventsWithoutOperations) > 0 {
+		logger.Warnw("found orphaned operations",
+			"operations_without_events", len(result.OperationsWithoutEvents),
+			"events_without_operations", len(result.EventsWithoutOperations),
+			"truncated", result.Truncated,
+		)
+	}
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling check orphaned operations response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("orphaned operations checked", "max_operation_id", maxOperationID, "max_event_id", maxEventID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+func writeOrphanScanError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		logger.Errorf("check orphaned operations cancelled: %s", err.Error())
+		writeHTTPError(w, http.StatusGatewayTimeout, fmt.Errorf("error scan cancelled: %w", err))
+		return
+	}
+
+	logger.Errorf("error executing check orphaned operations database operations: %s", err.Error())
+	writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+	debug.PrintStack()
+}
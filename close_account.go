@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+type closeAccountRequest struct {
+	AccountID uint64 `json:"account_id"`
+}
+
+// HandleCloseAccountWithContext closes an account for good once its
+// balance and held amount are both zero, after which no more
+// operations can be played on it, see ErrAccountClosed.
+func HandleCloseAccountWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received close account request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req closeAccountRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.AccountID == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+
+	logger.Infow("handling close account request", "request", redacted(req))
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Errorf("error beginning close account transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := CloseAccountWithContext(ctx, tx, req.AccountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if errors.Is(err, ErrAccountNotEmpty) {
+		writeHTTPError(w, http.StatusConflict, ErrAccountNotEmpty)
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing close account database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing close account database state: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledAccount, err := json.Marshal(account)
+	if err != nil {
+		logger.Errorf("error marshaling close account response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account closed", "request", redacted(req), "account", redacted(account))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledAccount)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleCloseAccountNotEmpty(t *testing.T) {
+	pool := testPool(t)
+
+	tests := []struct {
+		name       string
+		operations []operationRequest
+	}{
+		{name: "balance", operations: []operationRequest{op("CREDIT", 100)}},
+		{name: "held", operations: []operationRequest{op("CREDIT", 100), op("HOLD", 100)}},
+		{name: "both", operations: []operationRequest{op("CREDIT", 100), op("HOLD", 40)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testAccount(t, pool)
+			testPlay(t, pool, account.AccountID, tt.operations...)
+
+			w := testRequest(t, HandleCloseAccountWithContext, pool, http.MethodPost, "/close_account", closeAccountRequest{AccountID: account.AccountID})
+			if w.Code != http.StatusConflict {
+				t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"code":"ACCOUNT_NOT_EMPTY"`) {
+				t.Errorf("expected code ACCOUNT_NOT_EMPTY, got %s", w.Body.String())
+			}
+
+			// still open, operations are still played on it
+			testPlay(t, pool, account.AccountID, op("CREDIT", 1))
+		})
+	}
+}
+
+func TestHandleCloseAccountEmpty(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 100))
+
+	w := testRequest(t, HandleCloseAccountWithContext, pool, http.MethodPost, "/close_account", closeAccountRequest{AccountID: account.AccountID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+		AccountID:  account.AccountID,
+		Tenant:     testTenant,
+		Operations: []operationRequest{op("CREDIT", 100)},
+	})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"ACCOUNT_CLOSED"`) {
+		t.Errorf("expected code ACCOUNT_CLOSED, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxConcurrentRequestsPerAccountEnvVar = "MAX_CONCURRENT_REQUESTS_PER_ACCOUNT"
+	adminTokenEnvVar                      = "ADMIN_TOKEN"
+	maxOperationsPerTransactionReadEnvVar = "MAX_OPERATIONS_PER_TRANSACTION_READ"
+	maxOperationsPerRequestEnvVar         = "MAX_OPERATIONS_PER_REQUEST"
+	allowedTenantsEnvVar                  = "ALLOWED_TENANTS"
+	poolWarmupConnectionsEnvVar           = "POOL_WARMUP_CONNECTIONS"
+	adminReplayProtectionEnvVar           = "ADMIN_REPLAY_PROTECTION"
+	adminSigningKeyEnvVar                 = "ADMIN_SIGNING_KEY"
+	adminReplayWindowEnvVar               = "ADMIN_REPLAY_WINDOW"
+	redactedLogFieldsEnvVar               = "REDACTED_LOG_FIELDS"
+	tenantConfigsEnvVar                   = "TENANT_CONFIGS"
+	snapshotSigningKeyEnvVar              = "SNAPSHOT_SIGNING_KEY"
+	responseCacheSizeEnvVar               = "RESPONSE_CACHE_SIZE"
+	optimisticAccountLockingEnvVar        = "OPTIMISTIC_ACCOUNT_LOCKING"
+	txRetryAttemptsEnvVar                 = "TX_RETRY_ATTEMPTS"
+	txRetryMaxBackoffEnvVar               = "TX_RETRY_MAX_BACKOFF"
+	debugResponsesEnvVar                  = "DEBUG_RESPONSES"
+	concurrencyRetryAfterEnvVar           = "CONCURRENCY_RETRY_AFTER"
+	unavailableRetryAfterEnvVar           = "UNAVAILABLE_RETRY_AFTER"
+	tracingEndpointEnvVar                 = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	dbMaxOpenConnsEnvVar                  = "DB_MAX_OPEN_CONNS"
+	dbMaxIdleConnsEnvVar                  = "DB_MAX_IDLE_CONNS"
+	dbConnMaxLifetimeEnvVar               = "DB_CONN_MAX_LIFETIME"
+	maxTenantTimeoutEnvVar                = "MAX_TENANT_TIMEOUT"
+	businessRejectionStatusEnvVar         = "BUSINESS_REJECTION_STATUS"
+	strictEventSequencesEnvVar            = "STRICT_EVENT_SEQUENCES"
+	postgresBinariesPathEnvVar            = "POSTGRES_BINARIES_PATH"
+	embeddedPostgresPortEnvVar            = "EMBEDDED_POSTGRES_PORT"
+	embeddedPostgresDataPathEnvVar        = "EMBEDDED_POSTGRES_DATA_PATH"
+	embeddedPostgresRuntimePathEnvVar     = "EMBEDDED_POSTGRES_RUNTIME_PATH"
+	shutdownGracePeriodEnvVar             = "SHUTDOWN_GRACE_PERIOD"
+	shutdownCancelReserveEnvVar           = "SHUTDOWN_CANCEL_RESERVE"
+	createAccountRatePerMinuteEnvVar      = "CREATE_ACCOUNT_RATE_PER_MINUTE"
+	createAccountRatePerMinutePerIPEnvVar = "CREATE_ACCOUNT_RATE_PER_MINUTE_PER_IP"
+	idempotencyKeyTTLEnvVar               = "IDEMPOTENCY_KEY_TTL"
+	idempotencyKeyCleanupIntervalEnvVar   = "IDEMPOTENCY_KEY_CLEANUP_INTERVAL"
+	playIsolationLevelEnvVar              = "PLAY_ISOLATION_LEVEL"
+	maxRequestBodyBytesEnvVar             = "MAX_REQUEST_BODY_BYTES"
+	healthCheckTimeoutEnvVar              = "HEALTH_CHECK_TIMEOUT"
+	createAccountTimeoutEnvVar            = "CREATE_ACCOUNT_TIMEOUT"
+	executeOperationsTimeoutEnvVar        = "EXECUTE_OPERATIONS_TIMEOUT"
+	getTimeoutEnvVar                      = "GET_TIMEOUT"
+	integrityCheckTimeoutEnvVar           = "INTEGRITY_CHECK_TIMEOUT"
+	streamTimeoutEnvVar                   = "STREAM_TIMEOUT"
+)
+
+// Config holds the runtime tunables of the server,
+// all of which are optional and fall back to defaults
+// that preserve the behaviour prior to them existing.
+type Config struct {
+	// zero disables the limit
+	MaxConcurrentRequestsPerAccount int
+	// admin endpoints are disabled when empty
+	AdminToken string
+	// the most operations get_transaction will aggregate,
+	// the most recent ones are kept when there are more
+	MaxOperationsPerTransactionRead int
+	MaxOperationsPerRequest         int
+	// any tenant is allowed when empty
+	AllowedTenants []string
+	// connections opened before serving traffic
+	PoolWarmupConnections int
+	// when enabled, admin requests must also be signed
+	// with the signing key, see verifyAdminRequestSignature
+	AdminReplayProtection bool
+	AdminSigningKey       string
+	AdminReplayWindow     time.Duration
+	// JSON field names masked wherever requests
+	// and results are logged, see redacted
+	RedactedLogFields []string
+	// keyed by tenant, tenants without
+	// one get the zero TenantConfig
+	TenantConfigs map[string]TenantConfig
+	// account snapshots are disabled when empty,
+	// see SignAccountSnapshot for the scheme
+	SnapshotSigningKey string
+	// responses of immutable reads kept in memory,
+	// zero disables the cache
+	ResponseCacheSize int
+	// when enabled, execute_operations reads the account without
+	// locking it and only updates it if nothing played it since,
+	// trying the whole play again otherwise, see withRetryableTx
+	OptimisticAccountLocking bool
+	// how many times a transaction failing to serialize is
+	// attempted, backing off exponentially up to the max between
+	TxRetryAttempts   int
+	TxRetryMaxBackoff time.Duration
+	// lets execute_operations requests ask for the full played
+	// outcome, meant for integration testing rather than production
+	DebugResponses bool
+	// the Retry-After sent when rejecting requests over the per
+	// account concurrency limit, and when the server can't serve
+	// them for now, see writeRetryableHTTPError
+	ConcurrencyRetryAfter time.Duration
+	UnavailableRetryAfter time.Duration
+	// where spans are exported to over OTLP/HTTP,
+	// tracing is a no-op when empty
+	TracingEndpoint string
+	// sizing of the database connection pool, see connect
+	Pool poolConfig
+	// how long each kind of request is given, see timeoutsConfig
+	Timeouts timeoutsConfig
+	// the most a tenant's timeout override can extend
+	// execute_operations to, see TenantConfig.ExecuteOperationsTimeout
+	MaxTenantTimeout time.Duration
+	// the status requests are rejected with when they break a
+	// business rule rather than being malformed, 422 or 400.
+	// that's playing into a negative balance or hold, overflowing
+	// an amount, an account's hold limits or insufficient funds,
+	// and reversals and releases the transaction doesn't allow.
+	// the error body is the same either way, and server errors
+	// keep their 500s and 503s
+	BusinessRejectionStatus int
+	// when enabled, the events of a play are checked to carry on the
+	// account's log without a gap before they're recorded, on top of
+	// the unique index on their sequences, see checkEventSequences
+	StrictEventSequences bool
+	// a directory holding an already extracted postgres, i.e. with
+	// its bin/, lib/ and share/, that the embedded postgres is run
+	// from instead of downloading one on first start, for running
+	// offline e.g. in CI. it's extracted there when missing
+	PostgresBinariesPath string
+	// where the embedded postgres listens and keeps its data and
+	// runtime files, embedded-postgres' defaults when the paths are
+	// empty. instances sharing a host each need their own of all three
+	EmbeddedPostgresPort        int
+	EmbeddedPostgresDataPath    string
+	EmbeddedPostgresRuntimePath string
+	// how long in-flight requests are waited on once shutting down,
+	// the main context is only cancelled when the reserve is all
+	// that's left of it, for the requests to error out within
+	ShutdownGracePeriod   time.Duration
+	ShutdownCancelReserve time.Duration
+	// how many accounts /create_account creates a minute, across
+	// all clients and for each source IP, bursting up to a minute's
+	// worth at once. zero disables either, see RateLimiter
+	CreateAccountRatePerMinute      int
+	CreateAccountRatePerMinutePerIP int
+	// how long idempotency keys are kept, zero forever. an expired
+	// key no longer replays its response, a retry arriving any later
+	// is played again as a new request, so it has to outlast how long
+	// clients keep retrying. expired keys are deleted every interval
+	IdempotencyKeyTTL             time.Duration
+	IdempotencyKeyCleanupInterval time.Duration
+	// the isolation of the transactions operations are played in,
+	// read_committed or serializable, see PlayTxOptions
+	PlayIsolationLevel sql.IsolationLevel
+	// request bodies any larger are rejected unread past
+	// the limit, see limitRequestBody
+	MaxRequestBodyBytes int
+}
+
+// poolConfig sizes the database connection pool. requests
+// beyond MaxOpenConns wait for a connection to free up rather
+// than opening more than the database is able to serve.
+type poolConfig struct {
+	MaxOpenConns int
+	// connections kept open between requests, at most MaxOpenConns
+	MaxIdleConns int
+	// connections are closed once this old, zero keeps them forever
+	ConnMaxLifetime time.Duration
+}
+
+// timeoutsConfig is how long requests are given before their context
+// is cancelled, by the kind of request. the slowest have to finish
+// inside the server's write timeout for their response to be written.
+type timeoutsConfig struct {
+	HealthCheck   time.Duration
+	CreateAccount time.Duration
+	// the default, tenants can override it up to MaxTenantTimeout
+	ExecuteOperations time.Duration
+	Get               time.Duration
+	// whole account scans, e.g. reconciling an account
+	IntegrityCheck time.Duration
+	// responses streamed as they're read, e.g. exporting an account,
+	// which aren't bound by the server's write timeout, see
+	// extendWriteDeadline, so can take as long as this
+	Stream time.Duration
+}
+
+// TenantConfig holds the tunables that can differ between
+// tenants, loaded from the env as a JSON object keyed by tenant,
+// e.g. {"payments": {"max_transaction_age_days": 90,
+// "fees": {"DEBIT": {"flat_in_cents": 25, "basis_points": 150}}}}.
+type TenantConfig struct {
+	// transactions older than this can't be extended,
+	// closing them with the accounting period. zero disables it
+	MaxTransactionAgeDays int `json:"max_transaction_age_days"`
+	// keyed by operation type, nothing is charged
+	// for operation types without a schedule
+	Fees map[string]FeeSchedule `json:"fees"`
+	// operations are additionally numbered across all of the
+	// tenant's transactions, for consumers ordering them globally
+	TenantSequence bool `json:"tenant_sequence"`
+	// a RELEASE can only release what a single HOLD of its
+	// transaction has left, otherwise all of them together
+	ReleaseSpecificHolds bool `json:"release_specific_holds"`
+	// replaces the execute_operations timeout for the tenant,
+	// up to MaxTenantTimeout. zero keeps the global timeout
+	ExecuteOperationsTimeoutInMs int64 `json:"execute_operations_timeout_in_ms"`
+	// the most holds of the tenant's that can be active on an
+	// account at once, i.e. pending authorizations. zero disables it
+	MaxActiveHoldsPerAccount int `json:"max_active_holds_per_account"`
+	// webhook URLs keyed by operation type, POSTed each operation
+	// of the type once it's committed, see enqueueOperationHooks
+	Hooks map[string]string `json:"hooks"`
+	// the most operations a transaction of the tenant's can have,
+	// fees included, appending past it is rejected. zero disables it
+	MaxOperationsPerTransaction int64 `json:"max_operations_per_transaction"`
+	// held funds can be moved between the transactions
+	// of an account, see HandleTransferHoldWithContext
+	HoldTransfers bool `json:"hold_transfers"`
+}
+
+var config Config
+
+// MustLoadConfig reads the server config from the env
+// and will panic if any of the values present are invalid.
+func MustLoadConfig() Config {
+	timeouts := timeoutsConfig{
+		HealthCheck:       MustLoadDurationEnvVarWithDefault(healthCheckTimeoutEnvVar, 100*time.Millisecond),
+		CreateAccount:     MustLoadDurationEnvVarWithDefault(createAccountTimeoutEnvVar, 100*time.Millisecond),
+		ExecuteOperations: MustLoadDurationEnvVarWithDefault(executeOperationsTimeoutEnvVar, 2000*time.Millisecond),
+		Get:               MustLoadDurationEnvVarWithDefault(getTimeoutEnvVar, 500*time.Millisecond),
+		IntegrityCheck:    MustLoadDurationEnvVarWithDefault(integrityCheckTimeoutEnvVar, 8000*time.Millisecond),
+		Stream:            MustLoadDurationEnvVarWithDefault(streamTimeoutEnvVar, 10*time.Minute),
+	}
+	loadedConfig := Config{
+		MaxConcurrentRequestsPerAccount: MustLoadIntEnvVarWithDefault(maxConcurrentRequestsPerAccountEnvVar, 0),
+		AdminToken:                      os.Getenv(adminTokenEnvVar),
+		MaxOperationsPerTransactionRead: MustLoadIntEnvVarWithDefault(maxOperationsPerTransactionReadEnvVar, 1000),
+		MaxOperationsPerRequest:         MustLoadIntEnvVarWithDefault(maxOperationsPerRequestEnvVar, 1000),
+		AllowedTenants:                  LoadListEnvVar(allowedTenantsEnvVar),
+		PoolWarmupConnections:           MustLoadIntEnvVarWithDefault(poolWarmupConnectionsEnvVar, 0),
+		AdminReplayProtection:           MustLoadBoolEnvVarWithDefault(adminReplayProtectionEnvVar, false),
+		AdminSigningKey:                 os.Getenv(adminSigningKeyEnvVar),
+		AdminReplayWindow:               MustLoadDurationEnvVarWithDefault(adminReplayWindowEnvVar, 5*time.Minute),
+		RedactedLogFields:               LoadListEnvVarWithDefault(redactedLogFieldsEnvVar, []string{"user_ari"}),
+		TenantConfigs:                   MustLoadTenantConfigsEnvVar(tenantConfigsEnvVar),
+		SnapshotSigningKey:              os.Getenv(snapshotSigningKeyEnvVar),
+		ResponseCacheSize:               MustLoadIntEnvVarWithDefault(responseCacheSizeEnvVar, 0),
+		OptimisticAccountLocking:        MustLoadBoolEnvVarWithDefault(optimisticAccountLockingEnvVar, false),
+		TxRetryAttempts:                 MustLoadIntEnvVarWithDefault(txRetryAttemptsEnvVar, 3),
+		TxRetryMaxBackoff:               MustLoadDurationEnvVarWithDefault(txRetryMaxBackoffEnvVar, 200*time.Millisecond),
+		DebugResponses:                  MustLoadBoolEnvVarWithDefault(debugResponsesEnvVar, false),
+		ConcurrencyRetryAfter:           MustLoadDurationEnvVarWithDefault(concurrencyRetryAfterEnvVar, 1*time.Second),
+		UnavailableRetryAfter:           MustLoadDurationEnvVarWithDefault(unavailableRetryAfterEnvVar, 5*time.Second),
+		TracingEndpoint:                 os.Getenv(tracingEndpointEnvVar),
+		Pool: poolConfig{
+			MaxOpenConns:    MustLoadIntEnvVarWithDefault(dbMaxOpenConnsEnvVar, 50),
+			MaxIdleConns:    MustLoadIntEnvVarWithDefault(dbMaxIdleConnsEnvVar, 50),
+			ConnMaxLifetime: MustLoadDurationEnvVarWithDefault(dbConnMaxLifetimeEnvVar, 30*time.Minute),
+		},
+		Timeouts:                        timeouts,
+		MaxTenantTimeout:                MustLoadDurationEnvVarWithDefault(maxTenantTimeoutEnvVar, timeouts.ExecuteOperations),
+		BusinessRejectionStatus:         MustLoadIntEnvVarWithDefault(businessRejectionStatusEnvVar, http.StatusUnprocessableEntity),
+		StrictEventSequences:            MustLoadBoolEnvVarWithDefault(strictEventSequencesEnvVar, false),
+		PostgresBinariesPath:            os.Getenv(postgresBinariesPathEnvVar),
+		EmbeddedPostgresPort:            MustLoadIntEnvVarWithDefault(embeddedPostgresPortEnvVar, 5433),
+		EmbeddedPostgresDataPath:        os.Getenv(embeddedPostgresDataPathEnvVar),
+		EmbeddedPostgresRuntimePath:     os.Getenv(embeddedPostgresRuntimePathEnvVar),
+		ShutdownGracePeriod:             MustLoadDurationEnvVarWithDefault(shutdownGracePeriodEnvVar, 5*time.Second),
+		ShutdownCancelReserve:           MustLoadDurationEnvVarWithDefault(shutdownCancelReserveEnvVar, 1*time.Second),
+		CreateAccountRatePerMinute:      MustLoadIntEnvVarWithDefault(createAccountRatePerMinuteEnvVar, 0),
+		CreateAccountRatePerMinutePerIP: MustLoadIntEnvVarWithDefault(createAccountRatePerMinutePerIPEnvVar, 0),
+		IdempotencyKeyTTL:               MustLoadDurationEnvVarWithDefault(idempotencyKeyTTLEnvVar, 0),
+		IdempotencyKeyCleanupInterval:   MustLoadDurationEnvVarWithDefault(idempotencyKeyCleanupIntervalEnvVar, 1*time.Hour),
+		PlayIsolationLevel:              MustLoadIsolationLevelEnvVarWithDefault(playIsolationLevelEnvVar, sql.LevelReadCommitted),
+		MaxRequestBodyBytes:             MustLoadIntEnvVarWithDefault(maxRequestBodyBytesEnvVar, 1<<20),
+	}
+
+	if loadedConfig.AdminReplayProtection && loadedConfig.AdminSigningKey == "" {
+		panic("missing env var")
+	}
+	if loadedConfig.TxRetryAttempts < 1 {
+		panic("invalid env var")
+	}
+	if loadedConfig.EmbeddedPostgresPort < 1 || loadedConfig.EmbeddedPostgresPort > 65535 {
+		panic("invalid env var")
+	}
+	if loadedConfig.BusinessRejectionStatus != http.StatusUnprocessableEntity && loadedConfig.BusinessRejectionStatus != http.StatusBadRequest {
+		panic("invalid env var")
+	}
+	if loadedConfig.ShutdownCancelReserve < 0 || loadedConfig.ShutdownCancelReserve > loadedConfig.ShutdownGracePeriod {
+		panic("invalid env var")
+	}
+	if loadedConfig.IdempotencyKeyTTL < 0 || loadedConfig.IdempotencyKeyCleanupInterval <= 0 {
+		panic("invalid env var")
+	}
+	if loadedConfig.MaxRequestBodyBytes < 1 {
+		panic("invalid env var")
+	}
+	// the handler only ever tightens the timeout it's given
+	if loadedConfig.MaxTenantTimeout < timeouts.ExecuteOperations {
+		panic("invalid env var")
+	}
+	for _, timeout := range []time.Duration{timeouts.HealthCheck, timeouts.CreateAccount, timeouts.ExecuteOperations, timeouts.Get, timeouts.IntegrityCheck, loadedConfig.MaxTenantTimeout} {
+		if timeout <= 0 || timeout >= httpWriteTimeout {
+			panic("invalid env var")
+		}
+	}
+	if timeouts.Stream <= 0 {
+		panic("invalid env var")
+	}
+	if loadedConfig.Pool.MaxOpenConns < 1 || loadedConfig.Pool.MaxIdleConns < 0 || loadedConfig.Pool.ConnMaxLifetime < 0 {
+		panic("invalid env var")
+	}
+	// warming up more connections than the pool can hold
+	// would wait on itself until the warmup timed out
+	if loadedConfig.PoolWarmupConnections < 0 || loadedConfig.PoolWarmupConnections > loadedConfig.Pool.MaxOpenConns {
+		panic("invalid env var")
+	}
+
+	return loadedConfig
+}
+
+// IsTenantAllowed reports whether requests may be made on
+// behalf of the tenant.
+func (c Config) IsTenantAllowed(tenant string) bool {
+	if len(c.AllowedTenants) == 0 {
+		return true
+	}
+
+	for i := range c.AllowedTenants {
+		if c.AllowedTenants[i] == tenant {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TenantConfig returns the config of the tenant.
+func (c Config) TenantConfig(tenant string) TenantConfig {
+	return c.TenantConfigs[tenant]
+}
+
+// IsTransactionClosed reports whether a transaction created
+// at the given time is too old to be extended as of now.
+func (t TenantConfig) IsTransactionClosed(created time.Time, now time.Time) bool {
+	if t.MaxTransactionAgeDays <= 0 {
+		return false
+	}
+
+	return now.Sub(created) > time.Duration(t.MaxTransactionAgeDays)*24*time.Hour
+}
+
+// ExecuteOperationsTimeout returns the tenant's execute_operations
+// timeout, the global one unless overridden, clamped to at most max.
+func (t TenantConfig) ExecuteOperationsTimeout(global time.Duration, max time.Duration) time.Duration {
+	if t.ExecuteOperationsTimeoutInMs <= 0 {
+		return global
+	}
+
+	timeout := time.Duration(t.ExecuteOperationsTimeoutInMs) * time.Millisecond
+	if timeout > max {
+		return max
+	}
+
+	return timeout
+}
+
+// MustLoadIntEnvVarWithDefault takes an input env variable
+// and will attempt to load it from the env as an integer,
+// returning the default if it isn't set.
+// If it is set but isn't an integer, it will panic.
+func MustLoadIntEnvVarWithDefault(envVar string, defaultValue int) int {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		panic("invalid env var")
+	}
+
+	return parsed
+}
+
+// MustLoadBoolEnvVarWithDefault takes an input env variable
+// and will attempt to load it from the env as a boolean,
+// returning the default if it isn't set.
+// If it is set but isn't a boolean, it will panic.
+func MustLoadBoolEnvVarWithDefault(envVar string, defaultValue bool) bool {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		panic("invalid env var")
+	}
+
+	return parsed
+}
+
+// MustLoadDurationEnvVarWithDefault takes an input env variable
+// and will attempt to load it from the env as a duration (e.g. 5m),
+// returning the default if it isn't set.
+// If it is set but isn't a duration, it will panic.
+func MustLoadDurationEnvVarWithDefault(envVar string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		panic("invalid env var")
+	}
+
+	return parsed
+}
+
+// LoadListEnvVar takes an input env variable holding a
+// comma separated list and will attempt to load it from
+// the env, returning nil if it isn't set.
+func LoadListEnvVar(envVar string) []string {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// LoadListEnvVarWithDefault takes an input env variable holding
+// a comma separated list and will attempt to load it from the env,
+// returning the default if it isn't set.
+func LoadListEnvVarWithDefault(envVar string, defaultValue []string) []string {
+	if _, ok := os.LookupEnv(envVar); !ok {
+		return defaultValue
+	}
+
+	return LoadListEnvVar(envVar)
+}
+
+// MustLoadTenantConfigsEnvVar takes an input env variable holding
+// a JSON object of tenant configs keyed by tenant and will attempt
+// to load it from the env, returning nil if it isn't set.
+// If it is set but isn't valid, it will panic.
+func MustLoadTenantConfigsEnvVar(envVar string) map[string]TenantConfig {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	var tenantConfigs map[string]TenantConfig
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&tenantConfigs); err != nil {
+		panic("invalid env var")
+	}
+	for _, tenantConfig := range tenantConfigs {
+		if tenantConfig.MaxOperationsPerTransaction < 0 {
+			panic("invalid env var")
+		}
+		for _, feeSchedule := range tenantConfig.Fees {
+			if feeSchedule.FlatInCents < 0 || feeSchedule.BasisPoints < 0 {
+				panic("invalid env var")
+			}
+		}
+	}
+
+	return tenantConfigs
+}
+
+// MustLoadIsolationLevelEnvVarWithDefault reads an isolation level
+// by its name in postgres, lowercased with underscores.
+func MustLoadIsolationLevelEnvVarWithDefault(envVar string, defaultValue sql.IsolationLevel) sql.IsolationLevel {
+	switch os.Getenv(envVar) {
+	case "":
+		return defaultValue
+	case "read_committed":
+		return sql.LevelReadCommitted
+	case "serializable":
+		return sql.LevelSerializable
+	default:
+		panic("invalid env var")
+	}
+}
+
+// PlayTxOptions are the options of the transactions operations are played
+// in. serializable, postgres aborts any play that could have observed
+// another concurrently, with more 40001s to retry the busier accounts
+// are, see withRetryableTx. plays already lock their account, so it
+// costs throughput without changing their outcome, only guarding reads
+// that don't go through the account lock.
+func (c Config) PlayTxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: c.PlayIsolationLevel}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTenantConfigIsTransactionClosed(t *testing.T) {
+	// a fixed clock, the transaction's age is all that matters
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name         string
+		maxAgeDays   int
+		created      time.Time
+		expectClosed bool
+	}{
+		{name: "no maximum age", maxAgeDays: 0, created: now.Add(-1000 * day), expectClosed: false},
+		{name: "just created", maxAgeDays: 1, created: now, expectClosed: false},
+		{name: "younger than the maximum", maxAgeDays: 7, created: now.Add(-6 * day), expectClosed: false},
+		{name: "exactly the maximum", maxAgeDays: 7, created: now.Add(-7 * day), expectClosed: false},
+		{name: "just past the maximum", maxAgeDays: 7, created: now.Add(-7*day - time.Nanosecond), expectClosed: true},
+		{name: "well past the maximum", maxAgeDays: 7, created: now.Add(-30 * day), expectClosed: true},
+		{name: "created in another time zone", maxAgeDays: 1, created: now.Add(-day - time.Second).In(time.FixedZone("UTC+10", 10*60*60)), expectClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantConfig := TenantConfig{MaxTransactionAgeDays: tt.maxAgeDays}
+			if closed := tenantConfig.IsTransactionClosed(tt.created, now); closed != tt.expectClosed {
+				t.Errorf("expected closed %t, got %t", tt.expectClosed, closed)
+			}
+		})
+	}
+}
+
+func TestMustLoadConfigPoolWarmupConnections(t *testing.T) {
+	tests := []struct {
+		name              string
+		warmupConnections string
+		maxOpenConns      string
+		expectPanic       bool
+	}{
+		{name: "no warmup", warmupConnections: "0", maxOpenConns: "10"},
+		{name: "warming up part of the pool", warmupConnections: "5", maxOpenConns: "10"},
+		{name: "warming up the whole pool", warmupConnections: "10", maxOpenConns: "10"},
+		{name: "warming up more than the pool holds", warmupConnections: "11", maxOpenConns: "10", expectPanic: true},
+		{name: "negative warmup", warmupConnections: "-1", maxOpenConns: "10", expectPanic: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, poolWarmupConnectionsEnvVar, tt.warmupConnections)
+			setenv(t, dbMaxOpenConnsEnvVar, tt.maxOpenConns)
+
+			defer func() {
+				recovered := recover()
+				if tt.expectPanic && recovered == nil {
+					t.Errorf("expected loading the config to panic")
+				}
+				if !tt.expectPanic && recovered != nil {
+					t.Errorf("expected the config to load, got %v", recovered)
+				}
+			}()
+			MustLoadConfig()
+		})
+	}
+}
+
+func TestMustLoadConfigTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		envVar      string
+		value       string
+		timeout     func(Config) time.Duration
+		expected    time.Duration
+		expectPanic bool
+	}{
+		{name: "get default", timeout: func(c Config) time.Duration { return c.Timeouts.Get }, expected: 500 * time.Millisecond},
+		{name: "execute operations default", timeout: func(c Config) time.Duration { return c.Timeouts.ExecuteOperations }, expected: 2 * time.Second},
+		{name: "get configured", envVar: getTimeoutEnvVar, value: "2s", timeout: func(c Config) time.Duration { return c.Timeouts.Get }, expected: 2 * time.Second},
+		{name: "create account configured", envVar: createAccountTimeoutEnvVar, value: "750ms", timeout: func(c Config) time.Duration { return c.Timeouts.CreateAccount }, expected: 750 * time.Millisecond},
+		{name: "zero", envVar: getTimeoutEnvVar, value: "0s", expectPanic: true},
+		{name: "past the write timeout", envVar: getTimeoutEnvVar, value: httpWriteTimeout.String(), expectPanic: true},
+		{name: "not a duration", envVar: getTimeoutEnvVar, value: "soon", expectPanic: true},
+		// streams extend the write deadline as they go
+		{name: "stream past the write timeout", envVar: streamTimeoutEnvVar, value: "1h", timeout: func(c Config) time.Duration { return c.Timeouts.Stream }, expected: time.Hour},
+		{name: "stream zero", envVar: streamTimeoutEnvVar, value: "0s", expectPanic: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envVar != "" {
+				setenv(t, tt.envVar, tt.value)
+			}
+
+			defer func() {
+				recovered := recover()
+				if tt.expectPanic && recovered == nil {
+					t.Errorf("expected loading the config to panic")
+				}
+				if !tt.expectPanic && recovered != nil {
+					t.Errorf("expected the config to load, got %v", recovered)
+				}
+			}()
+			loadedConfig := MustLoadConfig()
+			if got := tt.timeout(loadedConfig); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// setenv sets the env var for the rest of the test, restoring it after.
+func setenv(t *testing.T, envVar string, value string) {
+	previous, ok := os.LookupEnv(envVar)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(envVar, previous)
+		} else {
+			os.Unsetenv(envVar)
+		}
+	})
+	os.Setenv(envVar, value)
+}
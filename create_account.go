@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -16,14 +17,24 @@ type createAccountRequest struct {
 func HandleCreateAccountWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
 	defer logger.Sync()
 	logger.Info("received create account request")
+	// per source IP first, so a single client flooding
+	// doesn't use up what everyone else is allowed
+	if allowed, retryAfter := createAccountIPLimiter.Allow(sourceIP(r)); !allowed {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, retryAfter, fmt.Errorf("error too many accounts created from this address"))
+		return
+	}
+	if allowed, retryAfter := createAccountLimiter.Allow(""); !allowed {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, retryAfter, fmt.Errorf("error too many accounts created"))
+		return
+	}
 	if r.Body == nil {
 		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
 		return
 	}
 
 	var req createAccountRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeHTTPError(w, http.StatusUnprocessableEntity, fmt.Errorf("error decoding request body: %w", err))
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
 		return
 	}
 
@@ -32,7 +43,7 @@ func HandleCreateAccountWithContext(ctx context.Context, pool *sql.DB, w http.Re
 		return
 	}
 
-	logger.Infow("handling create account request", "request", req)
+	logger.Infow("handling create account request", "request", redacted(req))
 	tx, err := pool.BeginTx(ctx, nil)
 	if err != nil {
 		logger.Errorf("error beginning create account transaction: %s", err.Error())
@@ -45,6 +56,12 @@ func HandleCreateAccountWithContext(ctx context.Context, pool *sql.DB, w http.Re
 	}()
 
 	account, err := CreateAccountWithContext(ctx, tx, req.UserARI)
+	if errors.Is(err, ErrAccountAlreadyExists) {
+		// the failed insert aborted the transaction
+		tx.Rollback()
+		writeAccountAlreadyExists(ctx, pool, w, req.UserARI)
+		return
+	}
 	if err != nil {
 		logger.Errorf("error executing create account database operations: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
@@ -66,8 +83,42 @@ func HandleCreateAccountWithContext(ctx context.Context, pool *sql.DB, w http.Re
 		debug.PrintStack()
 		return
 	}
-	logger.Infow("account created", "request", req, "account", account)
+	logger.Infow("account created", "request", redacted(req), "account", redacted(account))
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(marshaledAccount)
 }
+
+// writeAccountAlreadyExists rejects creating an account for a user_ari
+// that has one, with the id of the existing account when it can be read.
+func writeAccountAlreadyExists(ctx context.Context, pool *sql.DB, w http.ResponseWriter, userARI string) {
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Errorf("error beginning existing account transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusConflict, ErrAccountAlreadyExists)
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	existing, err := GetAccountByUserARIWithContext(ctx, tx, userARI)
+	if err != nil {
+		logger.Errorf("error getting existing account: %s", err.Error())
+		writeHTTPError(w, http.StatusConflict, ErrAccountAlreadyExists)
+		return
+	}
+
+	marshaledData, err := json.Marshal(struct {
+		errorResponse
+		AccountID uint64 `json:"account_id"`
+	}{errorResponse{ErrAccountAlreadyExists.Error(), errorCode(http.StatusConflict, ErrAccountAlreadyExists)}, existing.AccountID})
+	if err != nil {
+		logger.Errorf("error marshaling create account response: %s", err.Error())
+		writeHTTPError(w, http.StatusConflict, ErrAccountAlreadyExists)
+		return
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandleCreateAccountDuplicateUserARI(t *testing.T) {
+	pool := testPool(t)
+	userARI := fmt.Sprintf("ari:test:%s:%d", t.Name(), time.Now().UnixNano())
+
+	w := testRequest(t, HandleCreateAccountWithContext, pool, http.MethodPost, "/create_account", createAccountRequest{UserARI: userARI})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the account to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	var created Account
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+
+	w = testRequest(t, HandleCreateAccountWithContext, pool, http.MethodPost, "/create_account", createAccountRequest{UserARI: userARI})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected creating the account again to conflict, got %d: %s", w.Code, w.Body.String())
+	}
+	var res struct {
+		errorResponse
+		AccountID uint64 `json:"account_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if res.Code != "ACCOUNT_ALREADY_EXISTS" {
+		t.Errorf("expected code ACCOUNT_ALREADY_EXISTS, got %s", res.Code)
+	}
+	if res.AccountID != created.AccountID {
+		t.Errorf("expected the existing account %d, got %d", created.AccountID, res.AccountID)
+	}
+
+	w = testRequest(t, HandleBatchCreateAccountsWithContext, pool, http.MethodPost, "/batch_create_accounts", batchCreateAccountsRequest{UserARIs: []string{userARI + ":other", userARI}})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected a batch with the user_ari to conflict, got %d: %s", w.Code, w.Body.String())
+	}
+	// none of the batch was created
+	w = testRequest(t, HandleCreateAccountWithContext, pool, http.MethodPost, "/create_account", createAccountRequest{UserARI: userARI + ":other"})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the rest of the batch not to have been created, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freePort is a port nothing is listening on, as of asking.
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error finding a free port: %s", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestSetupEmbeddedDBConcurrently(t *testing.T) {
+	// embedded postgres is downloaded otherwise, which tests can't rely on
+	if os.Getenv(postgresBinariesPathEnvVar) == "" {
+		t.Skipf("%s not set, skipping embedded postgres test", postgresBinariesPathEnvVar)
+	}
+
+	const instances = 2
+	configs := make([]Config, instances)
+	for i := range configs {
+		configs[i] = config
+		configs[i].EmbeddedPostgresPort = freePort(t)
+		configs[i].EmbeddedPostgresDataPath = t.TempDir()
+		configs[i].EmbeddedPostgresRuntimePath = t.TempDir()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, instances)
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			postgres, pool, err := setupEmbeddedDB(configs[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			t.Cleanup(func() {
+				pool.Close()
+				postgres.Stop()
+			})
+
+			// each pool is on its own instance
+			var port int
+			if err := pool.QueryRowContext(context.Background(), "SELECT inet_server_port()").Scan(&port); err != nil {
+				errs[i] = err
+				return
+			}
+			if port != configs[i].EmbeddedPostgresPort {
+				t.Errorf("expected instance %d on port %d, got %d", i, configs[i].EmbeddedPostgresPort, port)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("error setting up instance %d: %s", i, err)
+		}
+	}
+}
+
+// BenchmarkReadTxOptions compares reading an account and one of its
+// transactions, as get_account and get_transaction do, in read-only
+// and read-write transactions. as under the load tester's read bias,
+// most iterations play on the accounts instead, the reads' latency
+// is reported as ns/read.
+func BenchmarkReadTxOptions(b *testing.B) {
+	defer func(gate *AccountGate) {
+		accountGate = gate
+	}(accountGate)
+	accountGate = NewAccountGate(0)
+	pool := testPool(b)
+	// PAYNOW's, the most read of the load tester's tenants
+	const readBias = 0.3
+	const accounts = 10
+	accountIDs := make([]uint64, accounts)
+	transactionIDs := make([]uint64, accounts)
+	for i := range accountIDs {
+		accountIDs[i] = testAccount(b, pool).AccountID
+		transactionIDs[i] = testPlay(b, pool, accountIDs[i], op("CREDIT", 1000)).Transaction.TransactionID
+	}
+
+	benchmarks := []struct {
+		name      string
+		txOptions *sql.TxOptions
+	}{
+		{name: "read only", txOptions: readOnlyTxOptions},
+		{name: "read write", txOptions: nil},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			var reads, readNanos int64
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					i := r.Intn(accounts)
+					if r.Float64() >= readBias {
+						testRequest(b, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+							AccountID:  accountIDs[i],
+							Tenant:     testTenant,
+							Operations: []operationRequest{op("CREDIT", 10)},
+						})
+						continue
+					}
+
+					start := time.Now()
+					if err := readAccountAndTransaction(pool, bm.txOptions, accountIDs[i], transactionIDs[i]); err != nil {
+						b.Error(err)
+					}
+					atomic.AddInt64(&readNanos, int64(time.Since(start)))
+					atomic.AddInt64(&reads, 1)
+				}
+			})
+			if reads > 0 {
+				b.ReportMetric(float64(readNanos)/float64(reads), "ns/read")
+			}
+		})
+	}
+}
+
+// readAccountAndTransaction reads as get_account and get_transaction
+// do, in a transaction begun with the options.
+func readAccountAndTransaction(pool *sql.DB, txOptions *sql.TxOptions, accountID uint64, transactionID uint64) error {
+	tx, err := pool.BeginTx(context.Background(), txOptions)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := GetAccountWithContext(context.Background(), tx, accountID); err != nil {
+		return err
+	}
+	if _, err := GetTransactionAndOperationsWithContext(context.Background(), tx, testTenant, transactionID, config.MaxOperationsPerTransactionRead, OperationsFilter{}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
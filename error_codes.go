@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errorResponse is the body of every error response. the
+// message is for humans, clients should only rely on the code.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// the stable code of each sentinel error. errors wrapping others
+// come ahead of them, so they get their own, more specific code.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrFeeNegativeBalance, "FEE_NEGATIVE_BALANCE"},
+	{ErrInvalidPlayOrderNegativeBalance, "NEGATIVE_BALANCE"},
+	{ErrReleaseExceedsHold, "RELEASE_EXCEEDS_HOLD"},
+	{ErrInvalidPlayOrderNegativeHold, "NEGATIVE_HOLD"},
+	{ErrAccountOperationLimit, "ACCOUNT_OPERATION_LIMIT"},
+	{ErrTransactionOperationLimit, "TRANSACTION_OPERATION_LIMIT"},
+	{ErrTransactionAccountMismatch, "TRANSACTION_ACCOUNT_MISMATCH"},
+	{ErrInsufficientFunds, "INSUFFICIENT_FUNDS"},
+	{ErrUnknownOperationType, "UNKNOWN_OPERATION_TYPE"},
+	{ErrUnknownField, "UNKNOWN_FIELD"},
+	{ErrRequestBodyTooLarge, "REQUEST_BODY_TOO_LARGE"},
+	{ErrUnknownAmountUnit, "UNKNOWN_AMOUNT_UNIT"},
+	{ErrAmountOverflow, "AMOUNT_OVERFLOW"},
+	{ErrIdempotencyKeyReused, "IDEMPOTENCY_KEY_REUSED"},
+	{ErrTransactionClosed, "TRANSACTION_CLOSED"},
+	{ErrTransactionAlreadyReversed, "TRANSACTION_ALREADY_REVERSED"},
+	{ErrAccountClosed, "ACCOUNT_CLOSED"},
+	{ErrTooManyActiveHolds, "TOO_MANY_ACTIVE_HOLDS"},
+	{ErrAccountNotEmpty, "ACCOUNT_NOT_EMPTY"},
+	{ErrEventSequenceGap, "EVENT_SEQUENCE_GAP"},
+	{ErrAccountingInconsistency, "ACCOUNTING_INCONSISTENCY"},
+	{ErrDuplicateSequence, "DUPLICATE_SEQUENCE"},
+	{ErrAccountAlreadyExists, "ACCOUNT_ALREADY_EXISTS"},
+	{ErrConcurrentModification, "CONCURRENT_MODIFICATION"},
+	{ErrNotFound, "NOT_FOUND"},
+}
+
+// the code of errors without one of their own, by the status
+// they're written with, e.g. any malformed request is VALIDATION
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:          "VALIDATION",
+	http.StatusUnauthorized:        "UNAUTHORIZED",
+	http.StatusForbidden:           "FORBIDDEN",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "CONFLICT",
+	http.StatusUnprocessableEntity: "REJECTED",
+	http.StatusTooManyRequests:     "TOO_MANY_REQUESTS",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusGatewayTimeout:      "TIMEOUT",
+	statusClientClosedRequest:      "CLIENT_CLOSED_REQUEST",
+}
+
+// errorCode returns the code to send the error with.
+func errorCode(statusCode int, err error) string {
+	for i := range errorCodes {
+		if errors.Is(err, errorCodes[i].err) {
+			return errorCodes[i].code
+		}
+	}
+	if code, ok := statusErrorCodes[statusCode]; ok {
+		return code
+	}
+
+	return "INTERNAL"
+}
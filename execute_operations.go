@@ -2,17 +2,50 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"sort"
+	"time"
 )
 
+const (
+	maxIdempotencyKeyLength = 255
+	maxClientFieldLength    = 255
+
+	debugHeader = "X-Debug"
+)
+
+// ends dry runs, so they're rolled back once played
+var errDryRun = errors.New("dry run, rolled back")
+
+// operationType is an operation type as sent over the API,
+// one of OperationTypes, anything else fails decoding the
+// request with ErrUnknownOperationType.
+type operationType string
+
+func (t *operationType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	if _, err := (Operation{OperationType: name}).Type(); err != nil {
+		return fmt.Errorf("error invalid operation_type %q: %w", name, err)
+	}
+
+	*t = operationType(name)
+	return nil
+}
+
 type operationRequest struct {
-	OperationType string `json:"operation_type"`
-	AmountInCents int64  `json:"amount_in_cents"`
+	OperationType operationType `json:"operation_type"`
+	// in the request's amount_unit until converted to cents
+	AmountInCents int64 `json:"amount_in_cents"`
 }
 
 type executeOperationsRequest struct {
@@ -20,207 +53,604 @@ type executeOperationsRequest struct {
 	Tenant        string             `json:"tenant"`
 	TransactionID uint64             `json:"transaction_id"`
 	Operations    []operationRequest `json:"operations"`
+	// optional, the unit the operation amounts are in, cents by default
+	AmountUnit string `json:"amount_unit,omitempty"`
+	// optional, a request retried with the same key gets
+	// the original response instead of being applied again
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// optional, the operations are played and the outcome
+	// returned as usual, but nothing is persisted
+	DryRun bool `json:"dry_run,omitempty"`
+	// optional, who the operations are played on behalf of, recorded
+	// in each of the request's operations' metadata as holds do
+	ClientIdentifier string `json:"client_identifier,omitempty"`
+	ClientUUID       string `json:"client_uuid,omitempty"`
+}
+
+// clientMetadata records the client that requested an operation
+// alongside it, so it can be told who to ask about it later.
+type clientMetadata struct {
+	Client struct {
+		ClientIdentifier string `json:"client_identifier,omitempty"`
+		ClientUUID       string `json:"client_uuid,omitempty"`
+	} `json:"client"`
 }
 
 type executeOperationsResponse struct {
-	Error       string      `json:"error"`
+	Error string `json:"error"`
+	// see errorResponse, only set along with the error
+	Code string `json:"code,omitempty"`
+	// set when the outcome was rolled back rather than committed,
+	// the transaction_id is then one that will never exist
+	DryRun      bool        `json:"dry_run,omitempty"`
 	Account     Account     `json:"account,omitempty"`
 	Transaction Transaction `json:"transaction,omitempty"`
+	// everything played on the transaction in order, fees
+	// included, with the ids and sequences they were given
+	Operations []Operation `json:"operations,omitempty"`
+	// charged on top of the requested operations
+	Fees []Operation `json:"fees,omitempty"`
+	// only set for debug requests, see debugRequested
+	Debug *debugOutcome `json:"debug,omitempty"`
+
+	accountBefore Account
+	played        PlayedOutcome
+}
+
+// debugOutcome is everything playing the operations produced,
+// for integrators to verify the exact state transitions against.
+type debugOutcome struct {
+	AccountBefore Account     `json:"account_before"`
+	AccountAfter  Account     `json:"account_after"`
+	Transaction   Transaction `json:"transaction"`
+	Operations    []Operation `json:"operations"`
+	Events        []Event     `json:"events"`
+}
+
+// debugRequested reports whether the request asked for the full played
+// outcome, which is only ever returned when debug responses are enabled.
+func debugRequested(r *http.Request) bool {
+	if !config.DebugResponses {
+		return false
+	}
+
+	return r.URL.Query().Get("debug") == "true" || r.Header.Get(debugHeader) == "true"
+}
+
+// decodeErrorStatus is the status to reject a request that failed to
+// decode with, a bad request when it named an unknown operation.
+func decodeErrorStatus(err error) int {
+	if errors.Is(err, ErrUnknownOperationType) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, ErrRequestBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusUnprocessableEntity
+}
+
+func (req executeOperationsRequest) Validate() error {
+	if req.Tenant == "" {
+		return fmt.Errorf("error missing required fields")
+	}
+	if !config.IsTenantAllowed(req.Tenant) {
+		return fmt.Errorf("error tenant not allowed")
+	}
+	if len(req.Operations) == 0 {
+		return fmt.Errorf("error missing required fields")
+	}
+	if len(req.Operations) > config.MaxOperationsPerRequest {
+		return fmt.Errorf("error too many operations, at most %d allowed per request", config.MaxOperationsPerRequest)
+	}
+	for i := range req.Operations {
+		if req.Operations[i].OperationType == "" || req.Operations[i].AmountInCents <= 0 {
+			return fmt.Errorf("error missing/invalid required fields")
+		}
+	}
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		return fmt.Errorf("error idempotency_key too long, at most %d characters allowed", maxIdempotencyKeyLength)
+	}
+	if len(req.ClientIdentifier) > maxClientFieldLength || len(req.ClientUUID) > maxClientFieldLength {
+		return fmt.Errorf("error client_identifier/client_uuid too long, at most %d characters allowed", maxClientFieldLength)
+	}
+	// a replayed dry run would look like it had been applied
+	if req.DryRun && req.IdempotencyKey != "" {
+		return fmt.Errorf("error idempotency_key isn't supported with dry_run")
+	}
+
+	return nil
+}
+
+// ConvertAmountsToCents converts the operation amounts from the
+// request's amount unit to cents, which everything past ingress
+// deals in, leaving the request in cents.
+func (req *executeOperationsRequest) ConvertAmountsToCents() error {
+	for i := range req.Operations {
+		amount, err := amountInCents(req.Operations[i].AmountInCents, req.AmountUnit)
+		if err != nil {
+			return err
+		}
+		req.Operations[i].AmountInCents = amount
+	}
+	req.AmountUnit = ""
+
+	return nil
+}
+
+// Hash fingerprints the request, telling a retry
+// apart from a different request reusing its key.
+func (req executeOperationsRequest) Hash() (string, error) {
+	marshaledData, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	sum := sha256.Sum256(marshaledData)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 func HandleExecuteOperationsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
 	defer logger.Sync()
 	logger.Info("received execute operations request")
+	start := time.Now()
+	outcome := executeOperationsOutcomeInvalid
+	defer func() {
+		observeExecuteOperations(outcome, time.Since(start))
+	}()
 	if r.Body == nil {
 		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
 		return
 	}
 
 	var req executeOperationsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeHTTPError(w, http.StatusUnprocessableEntity, fmt.Errorf("error decoding request body: %w", err))
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
 		return
 	}
 
-	if req.Tenant == "" {
-		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+	if err := req.ConvertAmountsToCents(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
-	if len(req.Operations) == 0 {
-		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+	if err := req.Validate(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
 		return
 	}
-	for i := range req.Operations {
-		if req.Operations[i].OperationType == "" || req.Operations[i].AmountInCents <= 0 {
-			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing/invalid required fields"))
-			return
-		}
-	}
 
-	logger.Infow("handling execute operations request", "request", req)
-	tx, err := pool.BeginTx(ctx, nil)
+	ctx, cancel := context.WithTimeout(ctx, config.TenantConfig(req.Tenant).ExecuteOperationsTimeout(config.Timeouts.ExecuteOperations, config.MaxTenantTimeout))
+	defer cancel()
+
+	operations, err := operationsFromRequest(req)
 	if err != nil {
-		logger.Errorf("error beginning transaction for execute operations request: %s", err.Error())
-		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
-		debug.PrintStack()
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	operations, err = operationsWithFees(req.Tenant, operations)
+	if err != nil {
+		writeHTTPError(w, config.BusinessRejectionStatus, err)
 		return
 	}
-	defer func() {
-		tx.Rollback()
-	}()
 
-	account, err := LockAccountWithContext(ctx, tx, req.AccountID)
+	if !accountGate.TryAcquire(req.AccountID) {
+		outcome = executeOperationsOutcomeTooManyConcurrent
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, config.ConcurrencyRetryAfter, fmt.Errorf("error too many concurrent requests for account"))
+		return
+	}
+	defer accountGate.Release(req.AccountID)
+
+	withDebug := debugRequested(r)
+	logger.Infow("handling execute operations request", "request", redacted(req), "debug", withDebug)
+	var marshaledData []byte
+	var result executeOperationsResponse
+	err = withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		var err error
+		marshaledData, result, err = executeOperationsInTx(ctx, tx, req, operations, withDebug)
+		return err
+	})
+	outcome = executeOperationsOutcome(err)
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if errors.Is(err, ErrConcurrentModification) {
+		logger.Warnw("giving up on concurrently modified account", "request", redacted(req), "error", err.Error())
+		writeHTTPError(w, http.StatusConflict, ErrConcurrentModification)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
 	if err != nil {
-		logger.Errorf("error locking account for execute operations request: %s", err.Error())
+		logger.Errorf("error executing operations for execute operations request: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
 		debug.PrintStack()
 		return
 	}
+	logger.Infow("operations executed", "request", redacted(req), "result", redacted(result))
+	observeOperationAmounts(req.Operations)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// executeOperationsInTx plays the operations, returning the response to
+// write once the transaction commits. requests that are rejected, or that
+// replay an idempotency key, fail with the earlyResponse to write instead.
+// withDebug, the response includes the full played outcome. dry runs
+// are played and persisted as usual, then rolled back with an early
+// response, so they're held to exactly what a real request would be.
+func executeOperationsInTx(ctx context.Context, tx *sql.Tx, req executeOperationsRequest, operations []Operation, withDebug bool) ([]byte, executeOperationsResponse, error) {
+	if req.IdempotencyKey != "" {
+		requestHash, err := req.Hash()
+		if err != nil {
+			return nil, executeOperationsResponse{}, err
+		}
+
+		reserved, err := ReserveIdempotencyKeyWithContext(ctx, tx, req.Tenant, req.IdempotencyKey, requestHash, config.IdempotencyKeyTTL)
+		if err != nil {
+			return nil, executeOperationsResponse{}, fmt.Errorf("error reserving idempotency key: %w", err)
+		}
+		if !reserved {
+			idempotencyKey, err := GetIdempotencyKeyWithContext(ctx, tx, req.Tenant, req.IdempotencyKey)
+			if err != nil {
+				return nil, executeOperationsResponse{}, fmt.Errorf("error getting idempotency key: %w", err)
+			}
+			if idempotencyKey.RequestHash != requestHash {
+				return nil, executeOperationsResponse{}, earlyHTTPError(http.StatusConflict, ErrIdempotencyKeyReused)
+			}
+
+			logger.Infow("replaying execute operations response", "request", redacted(req), "transaction_id", idempotencyKey.TransactionID.Int64)
+			return nil, executeOperationsResponse{}, earlyResponse{statusCode: http.StatusOK, body: idempotencyKey.Response}
+		}
+	}
+
+	// optimistically, the account is only checked
+	// to be unchanged when it's updated, see UpdateAccountWithContext
+	readAccountWithContext := LockAccountWithContext
+	if config.OptimisticAccountLocking {
+		readAccountWithContext = GetAccountWithContext
+	}
+	account, err := readAccountWithContext(ctx, tx, req.AccountID)
+	if err != nil {
+		return nil, executeOperationsResponse{}, fmt.Errorf("error reading account: %w", err)
+	}
 
 	var result executeOperationsResponse
+	errorResult := executeOperationsResponse{Account: account}
 	if req.TransactionID != 0 {
 		transaction, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
 		if err != nil {
-			logger.Errorf("error getting transaction for execute operations request: %s", err.Error())
-			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
-			debug.PrintStack()
-			return
-		}
-
-		result, err = processExistingTransaction(ctx, tx, req, account, transaction)
-		if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) || errors.Is(err, ErrInvalidPlayOrderNegativeHold) {
-			errorResult := executeOperationsResponse{
-				Error:       err.Error(),
-				Account:     account,
-				Transaction: transaction,
-			}
+			return nil, executeOperationsResponse{}, fmt.Errorf("error getting transaction: %w", err)
+		}
+		errorResult.Transaction = transaction
 
-			marshaledData, err := json.Marshal(errorResult)
-			if err != nil {
-				logger.Errorf("error marshaling response for execute operations request: %s", err.Error())
-				writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
-				debug.PrintStack()
-				return
-			}
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			w.Write(marshaledData)
-			return
+		result, err = processExistingTransaction(ctx, tx, operations, account, transaction)
+		if errors.Is(err, ErrTransactionAccountMismatch) {
+			return nil, executeOperationsResponse{}, earlyHTTPError(http.StatusForbidden, ErrTransactionAccountMismatch)
+		}
+		if errors.Is(err, ErrTransactionClosed) {
+			return nil, executeOperationsResponse{}, earlyHTTPError(http.StatusConflict, ErrTransactionClosed)
 		}
 	} else {
-		result, err = processNewTransaction(ctx, tx, req, account)
-		if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) || errors.Is(err, ErrInvalidPlayOrderNegativeHold) {
-			errorResult := executeOperationsResponse{
-				Error:   err.Error(),
-				Account: account,
-			}
-
-			marshaledData, err := json.Marshal(errorResult)
-			if err != nil {
-				logger.Errorf("error marshaling response for execute operations request: %s", err.Error())
-				writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
-				debug.PrintStack()
-				return
-			}
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			w.Write(marshaledData)
-			return
+		result, err = processNewTransaction(ctx, tx, req.Tenant, operations, account)
+	}
+	if errors.Is(err, ErrAccountClosed) {
+		return nil, executeOperationsResponse{}, earlyHTTPError(http.StatusConflict, ErrAccountClosed)
+	}
+	if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) || errors.Is(err, ErrInvalidPlayOrderNegativeHold) || errors.Is(err, ErrAmountOverflow) || errors.Is(err, ErrTooManyActiveHolds) || errors.Is(err, ErrTransactionOperationLimit) {
+		errorResult.Error = err.Error()
+		errorResult.Code = errorCode(config.BusinessRejectionStatus, err)
+		marshaledData, marshalErr := json.Marshal(errorResult)
+		if marshalErr != nil {
+			return nil, executeOperationsResponse{}, fmt.Errorf("error marshaling response: %w", marshalErr)
 		}
+
+		return nil, executeOperationsResponse{}, earlyResponse{statusCode: config.BusinessRejectionStatus, body: marshaledData, cause: err}
 	}
 	if err != nil {
-		logger.Errorf("error processing operations for execute operations request: %s", err.Error())
-		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error processing operations: %w", err))
-		debug.PrintStack()
-		return
+		return nil, executeOperationsResponse{}, fmt.Errorf("error processing operations: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		logger.Errorf("error committing transaction for execute operations request: %s", err.Error())
-		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
-		debug.PrintStack()
-		return
+	if withDebug {
+		result.Debug = &debugOutcome{
+			AccountBefore: result.accountBefore,
+			AccountAfter:  result.played.PlayedAccount,
+			Transaction:   result.played.PlayedTransaction,
+			Operations:    result.played.PlayedOperations,
+			Events:        result.played.PlayedEvents,
+		}
 	}
-	logger.Infow("operations executed", "request", req, "result", result)
 
+	result.DryRun = req.DryRun
+	// marshaled ahead of committing, the response is
+	// kept alongside the idempotency key to be replayed
 	marshaledData, err := json.Marshal(result)
 	if err != nil {
-		logger.Errorf("error marshaling response for execute operations request: %s", err.Error())
-		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
-		debug.PrintStack()
-		return
+		return nil, executeOperationsResponse{}, fmt.Errorf("error marshaling response: %w", err)
+	}
+	if req.DryRun {
+		return nil, executeOperationsResponse{}, earlyResponse{statusCode: http.StatusOK, body: marshaledData, cause: errDryRun}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(marshaledData)
+	if req.IdempotencyKey != "" {
+		if err := CompleteIdempotencyKeyWithContext(ctx, tx, req.Tenant, req.IdempotencyKey, result.Transaction.TransactionID, marshaledData); err != nil {
+			return nil, executeOperationsResponse{}, fmt.Errorf("error completing idempotency key: %w", err)
+		}
+	}
+
+	return marshaledData, result, nil
 }
 
-func processNewTransaction(ctx context.Context, tx *sql.Tx, req executeOperationsRequest, account Account) (executeOperationsResponse, error) {
-	transaction := Transaction{AccountID: req.AccountID, Tenant: req.Tenant}
+// operationsFromRequest builds the operations to play from the request,
+// with the client that requested them in their metadata when given.
+func operationsFromRequest(req executeOperationsRequest) ([]Operation, error) {
+	var marshaledMetadata json.RawMessage
+	if req.ClientIdentifier != "" || req.ClientUUID != "" {
+		var metadata clientMetadata
+		metadata.Client.ClientIdentifier = req.ClientIdentifier
+		metadata.Client.ClientUUID = req.ClientUUID
+		var err error
+		marshaledMetadata, err = json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling metadata: %w", err)
+		}
+	}
+
 	operations := make([]Operation, len(req.Operations))
 	for i := range req.Operations {
-		operations[i] = Operation{OperationType: req.Operations[i].OperationType, AmountInCents: req.Operations[i].AmountInCents}
+		operations[i] = Operation{OperationType: string(req.Operations[i].OperationType), AmountInCents: req.Operations[i].AmountInCents, Metadata: marshaledMetadata}
 	}
 
-	playedOutcome, err := account.Play(transaction, operations)
+	return operations, nil
+}
+
+func processNewTransaction(ctx context.Context, tx *sql.Tx, tenant string, operations []Operation, account Account) (executeOperationsResponse, error) {
+	return processNewTransactionWithOptions(ctx, tx, tenant, operations, account, PlayOptions{})
+}
+
+func processNewTransactionWithOptions(ctx context.Context, tx *sql.Tx, tenant string, operations []Operation, account Account, options PlayOptions) (executeOperationsResponse, error) {
+	if account.Status == accountStatusClosed {
+		return executeOperationsResponse{}, ErrAccountClosed
+	}
+	transaction := Transaction{AccountID: account.AccountID, Tenant: tenant}
+	// a new transaction has no holds to release yet
+	options.ReleaseSpecificHolds = config.TenantConfig(tenant).ReleaseSpecificHolds
+	options.MaxOperationsPerTransaction = config.TenantConfig(tenant).MaxOperationsPerTransaction
+	_, playSpan := tracer.Start(ctx, "PlayWithOptions")
+	playedOutcome, err := account.PlayWithOptions(transaction, operations, options)
+	playSpan.End()
 	if err != nil {
 		return executeOperationsResponse{}, fmt.Errorf("error playing operations: %w", err)
 	}
+	if err := checkActiveHolds(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations); err != nil {
+		return executeOperationsResponse{}, err
+	}
+	if err := checkEventSequences(account, playedOutcome.PlayedEvents); err != nil {
+		return executeOperationsResponse{}, err
+	}
+	// the account is updated before its events are inserted, with
+	// optimistic locking a concurrent play then fails the update with
+	// ErrConcurrentModification, rather than the insert on the unique
+	// sequence index with an error that isn't retried
+	if err := UpdateAccountWithContext(ctx, tx, playedOutcome.PlayedAccount, account.LastPlayedSequence); err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+	}
+	if err := assignTenantSequences(ctx, tx, transaction.Tenant, playedOutcome.PlayedOperations); err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error assigning tenant sequences: %w", err)
+	}
 
-	for i := range playedOutcome.PlayedOperations {
-		if i == 0 {
-			transactionID, err := CreateTransactionAndOperationWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[i], playedOutcome.PlayedEvents[i])
-			if err != nil {
-				return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
-			}
-			playedOutcome.PlayedTransaction.TransactionID = transactionID
-			continue
+	if len(playedOutcome.PlayedOperations) > 0 {
+		transactionID, operationID, err := CreateTransactionAndOperationWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[0], playedOutcome.PlayedEvents[0])
+		if err != nil {
+			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
 		}
-
-		if i == len(playedOutcome.PlayedOperations)-1 {
-			if err := AddOperationAndUpdateTransactionWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[i], playedOutcome.PlayedEvents[i]); err != nil {
-				return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
-			}
-			break
+		playedOutcome.PlayedTransaction.TransactionID = transactionID
+		for i := range playedOutcome.PlayedOperations {
+			playedOutcome.PlayedOperations[i].TransactionID = transactionID
+			playedOutcome.PlayedEvents[i].TransactionID = transactionID
 		}
 
-		if err := AddOperationToTransactionWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[i], playedOutcome.PlayedEvents[i]); err != nil {
+		// the transaction was created in its played state,
+		// the rest of the operations only need recording
+		operationIDs, err := BatchInsertOperationsAndEventsWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[1:], playedOutcome.PlayedEvents[1:])
+		if err != nil {
+			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+		}
+		setOperationIDs(playedOutcome.PlayedOperations, playedOutcome.PlayedEvents, append([]uint64{operationID}, operationIDs...))
+		if err := enqueueOperationHooks(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations, playedOutcome.PlayedEvents); err != nil {
 			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
 		}
 	}
 
-	if err := UpdateAccountWithContext(ctx, tx, playedOutcome.PlayedAccount); err != nil {
-		return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+	return executeOperationsResponse{
+		Account:     playedOutcome.PlayedAccount,
+		Transaction: playedOutcome.PlayedTransaction,
+		Operations:  playedOutcome.PlayedOperations,
+		Fees:        feeOperations(playedOutcome.PlayedOperations),
+
+		accountBefore: account,
+		played:        playedOutcome,
+	}, nil
+}
+
+// setOperationIDs sets the ids the operations were recorded with, on
+// them and on their events, so either can be looked up from the other.
+func setOperationIDs(operations []Operation, events []Event, operationIDs []uint64) {
+	for i := range operations {
+		operations[i].OperationID = operationIDs[i]
+		events[i].OperationID = operationIDs[i]
+	}
+}
+
+// checkEventSequences fails with ErrEventSequenceGap, when strict event
+// sequences are enabled, unless the events follow on from the account's
+// last played sequence one by one, as playing them always should.
+func checkEventSequences(account Account, events []Event) error {
+	if !config.StrictEventSequences {
+		return nil
 	}
 
-	return executeOperationsResponse{Account: playedOutcome.PlayedAccount, Transaction: playedOutcome.PlayedTransaction}, nil
+	for i := range events {
+		if events[i].Sequence != account.LastPlayedSequence+int64(i)+1 {
+			return fmt.Errorf("%w: event %d has sequence %d after %d", ErrEventSequenceGap, i, events[i].Sequence, account.LastPlayedSequence)
+		}
+	}
+
+	return nil
 }
 
-func processExistingTransaction(ctx context.Context, tx *sql.Tx, req executeOperationsRequest, account Account, transaction Transaction) (executeOperationsResponse, error) {
-	operations := make([]Operation, len(req.Operations))
-	for i := range req.Operations {
-		operations[i] = Operation{OperationType: req.Operations[i].OperationType, AmountInCents: req.Operations[i].AmountInCents}
+// checkActiveHolds fails with ErrTooManyActiveHolds when the operations
+// played on the transaction add a HOLD that takes the account past the
+// tenant's limit on active holds. a hold is active until its RELEASEs
+// net it out, see NetHeldOperations. this runs under the account lock,
+// or with optimistic locking the account update fails if a concurrent
+// hold got in first, so the count can't change before it's committed.
+func checkActiveHolds(ctx context.Context, tx *sql.Tx, transaction Transaction, operations []Operation) error {
+	maxActiveHolds := config.TenantConfig(transaction.Tenant).MaxActiveHoldsPerAccount
+	if maxActiveHolds <= 0 {
+		return nil
+	}
+	addsHold := false
+	for i := range operations {
+		addsHold = addsHold || operations[i].OperationType == "HOLD"
+	}
+	if !addsHold {
+		return nil
 	}
 
-	playedOutcome, err := account.Play(transaction, operations)
+	accountOperations, err := GetHoldAndReleaseOperationsWithContext(ctx, tx, transaction.AccountID)
 	if err != nil {
-		return executeOperationsResponse{}, fmt.Errorf("error playing operations: %w", err)
+		return fmt.Errorf("error getting hold and release operations: %w", err)
+	}
+	tenantOperations := []Operation{}
+	for i := range accountOperations {
+		if accountOperations[i].Tenant == transaction.Tenant {
+			tenantOperations = append(tenantOperations, accountOperations[i])
+		}
+	}
+	for i := range operations {
+		played := operations[i]
+		played.TransactionID = transaction.TransactionID
+		tenantOperations = append(tenantOperations, played)
+	}
+	// the played operations follow their transaction's
+	// earlier ones, which NetHeldOperations expects together
+	sort.SliceStable(tenantOperations, func(i, j int) bool {
+		return tenantOperations[i].TransactionID < tenantOperations[j].TransactionID
+	})
+
+	if len(NetHeldOperations(tenantOperations)) > maxActiveHolds {
+		return ErrTooManyActiveHolds
+	}
+
+	return nil
+}
+
+// assignTenantSequences numbers the played operations in the
+// tenant's sequence, when the tenant has one, after all of
+// the tenant's operations committed before them.
+func assignTenantSequences(ctx context.Context, tx *sql.Tx, tenant string, operations []Operation) error {
+	if !config.TenantConfig(tenant).TenantSequence || len(operations) == 0 {
+		return nil
+	}
+
+	firstSequence, err := ReserveTenantSequencesWithContext(ctx, tx, tenant, len(operations))
+	if err != nil {
+		return err
+	}
+	for i := range operations {
+		operations[i].TenantSequence = firstSequence + int64(i)
+	}
+
+	return nil
+}
+
+func processExistingTransaction(ctx context.Context, tx *sql.Tx, operations []Operation, account Account, transaction Transaction) (executeOperationsResponse, error) {
+	return processExistingTransactionWithOptions(ctx, tx, operations, account, transaction, PlayOptions{})
+}
+
+func processExistingTransactionWithOptions(ctx context.Context, tx *sql.Tx, operations []Operation, account Account, transaction Transaction, options PlayOptions) (executeOperationsResponse, error) {
+	// transactions are looked up by tenant and id alone,
+	// nothing else stops one being extended from another account
+	if transaction.AccountID != account.AccountID {
+		return executeOperationsResponse{}, ErrTransactionAccountMismatch
+	}
+	if account.Status == accountStatusClosed {
+		return executeOperationsResponse{}, ErrAccountClosed
 	}
 
-	for i := range playedOutcome.PlayedOperations {
-		if i == len(playedOutcome.PlayedOperations)-1 {
-			if err := AddOperationAndUpdateTransactionWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[i], playedOutcome.PlayedEvents[i]); err != nil {
-				return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+	tenantConfig := config.TenantConfig(transaction.Tenant)
+	if tenantConfig.MaxTransactionAgeDays > 0 {
+		created, err := GetTransactionCreatedWithContext(ctx, tx, transaction.Tenant, transaction.TransactionID)
+		if err != nil {
+			return executeOperationsResponse{}, fmt.Errorf("error getting transaction created: %w", err)
+		}
+		if tenantConfig.IsTransactionClosed(created, time.Now()) {
+			return executeOperationsResponse{}, ErrTransactionClosed
+		}
+	}
+	options.MaxOperationsPerTransaction = tenantConfig.MaxOperationsPerTransaction
+	if tenantConfig.ReleaseSpecificHolds {
+		options.ReleaseSpecificHolds = true
+		// with nothing held, every hold has been released
+		if transaction.HeldAmountInCents > 0 {
+			holdOperations, err := GetTransactionHoldAndReleaseOperationsWithContext(ctx, tx, transaction.Tenant, transaction.TransactionID)
+			if err != nil {
+				return executeOperationsResponse{}, fmt.Errorf("error getting hold and release operations: %w", err)
 			}
-			break
+			options.OutstandingHolds = OutstandingHolds(holdOperations)
 		}
+	}
 
-		if err := AddOperationToTransactionWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[i], playedOutcome.PlayedEvents[i]); err != nil {
+	_, playSpan := tracer.Start(ctx, "PlayWithOptions")
+	playedOutcome, err := account.PlayWithOptions(transaction, operations, options)
+	playSpan.End()
+	if err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error playing operations: %w", err)
+	}
+	if err := checkActiveHolds(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations); err != nil {
+		return executeOperationsResponse{}, err
+	}
+	if err := checkEventSequences(account, playedOutcome.PlayedEvents); err != nil {
+		return executeOperationsResponse{}, err
+	}
+	// the account is updated before its events are inserted, with
+	// optimistic locking a concurrent play then fails the update with
+	// ErrConcurrentModification, rather than the insert on the unique
+	// sequence index with an error that isn't retried
+	if err := UpdateAccountWithContext(ctx, tx, playedOutcome.PlayedAccount, account.LastPlayedSequence); err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+	}
+	if err := assignTenantSequences(ctx, tx, transaction.Tenant, playedOutcome.PlayedOperations); err != nil {
+		return executeOperationsResponse{}, fmt.Errorf("error assigning tenant sequences: %w", err)
+	}
+
+	if len(playedOutcome.PlayedOperations) > 0 {
+		operationID, err := AddOperationAndUpdateTransactionWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[0], playedOutcome.PlayedEvents[0])
+		if err != nil {
+			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+		}
+		operationIDs, err := BatchInsertOperationsAndEventsWithContext(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations[1:], playedOutcome.PlayedEvents[1:])
+		if err != nil {
+			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
+		}
+		setOperationIDs(playedOutcome.PlayedOperations, playedOutcome.PlayedEvents, append([]uint64{operationID}, operationIDs...))
+		if err := enqueueOperationHooks(ctx, tx, playedOutcome.PlayedTransaction, playedOutcome.PlayedOperations, playedOutcome.PlayedEvents); err != nil {
 			return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
 		}
 	}
 
-	if err := UpdateAccountWithContext(ctx, tx, playedOutcome.PlayedAccount); err != nil {
-		return executeOperationsResponse{}, fmt.Errorf("error updating played outcome state: %w", err)
-	}
+	return executeOperationsResponse{
+		Account:     playedOutcome.PlayedAccount,
+		Transaction: playedOutcome.PlayedTransaction,
+		Operations:  playedOutcome.PlayedOperations,
+		Fees:        feeOperations(playedOutcome.PlayedOperations),
 
-	return executeOperationsResponse{Account: playedOutcome.PlayedAccount, Transaction: playedOutcome.PlayedTransaction}, nil
+		accountBefore: account,
+		played:        playedOutcome,
+	}, nil
 }
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleExecuteOperationsTransactionAccountMismatch(t *testing.T) {
+	pool := testPool(t)
+	owner := testAccount(t, pool)
+	other := testAccount(t, pool)
+	played := testPlay(t, pool, owner.AccountID, op("CREDIT", 100))
+	testPlay(t, pool, other.AccountID, op("CREDIT", 100))
+
+	// the other account's id with the owner's transaction
+	w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+		AccountID:     other.AccountID,
+		Tenant:        testTenant,
+		TransactionID: played.Transaction.TransactionID,
+		Operations:    []operationRequest{op("DEBIT", 50)},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"TRANSACTION_ACCOUNT_MISMATCH"`) {
+		t.Errorf("expected code TRANSACTION_ACCOUNT_MISMATCH, got %s", w.Body.String())
+	}
+
+	// nothing was played on either
+	for _, account := range []Account{owner, other} {
+		if got := testGetAccount(t, pool, account.AccountID); got.RunningBalance != 100 || got.LastPlayedSequence != 1 {
+			t.Errorf("expected account %d unchanged, got balance %d at sequence %d", account.AccountID, got.RunningBalance, got.LastPlayedSequence)
+		}
+	}
+}
+
+func TestHandleExecuteOperationsDebugMatchesRead(t *testing.T) {
+	defer func(debugResponses bool) {
+		config.DebugResponses = debugResponses
+	}(config.DebugResponses)
+	config.DebugResponses = true
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 1000))
+
+	w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations?debug=true", executeOperationsRequest{
+		AccountID:  account.AccountID,
+		Tenant:     testTenant,
+		Operations: []operationRequest{op("DEBIT", 100), op("HOLD", 200), op("RELEASE", 50)},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected operations to be played, got %d: %s", w.Code, w.Body.String())
+	}
+	var res executeOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if res.Debug == nil {
+		t.Fatal("expected the played outcome")
+	}
+
+	tx, err := pool.BeginTx(context.Background(), readOnlyTxOptions)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer tx.Rollback()
+	read, err := GetTransactionAndOperationsWithContext(context.Background(), tx, testTenant, res.Debug.Transaction.TransactionID, 100, OperationsFilter{})
+	if err != nil {
+		t.Fatalf("error getting transaction: %s", err)
+	}
+	events, err := GetEventsWithContext(context.Background(), tx, account.AccountID, testTenant, sql.NullInt64{Int64: res.Debug.AccountBefore.LastPlayedSequence + 1, Valid: true}, sql.NullInt64{}, 100)
+	if err != nil {
+		t.Fatalf("error getting events: %s", err)
+	}
+
+	// primary keys are the database's, the outcome doesn't have them
+	accountAfter, readAccount := res.Debug.AccountAfter, testGetAccount(t, pool, account.AccountID)
+	accountAfter.AccountPK, readAccount.AccountPK = 0, 0
+	if accountAfter != readAccount {
+		t.Errorf("expected the account after %+v, read %+v", accountAfter, readAccount)
+	}
+	transaction, readTransaction := res.Debug.Transaction, read.Transaction
+	transaction.TransactionPK, readTransaction.TransactionPK = 0, 0
+	if transaction != readTransaction {
+		t.Errorf("expected the transaction %+v, read %+v", transaction, readTransaction)
+	}
+
+	if len(res.Debug.Operations) != len(read.Operations) {
+		t.Fatalf("expected %d operations, read %d", len(res.Debug.Operations), len(read.Operations))
+	}
+	readOperations := map[uint64]Operation{}
+	for _, operation := range read.Operations {
+		readOperations[operation.OperationID] = operation
+	}
+	for _, operation := range res.Debug.Operations {
+		readOperation := readOperations[operation.OperationID]
+		if operation.OperationType != readOperation.OperationType || operation.AmountInCents != readOperation.AmountInCents || operation.Sequence != readOperation.Sequence || operation.TransactionID != readOperation.TransactionID {
+			t.Errorf("expected operation %+v, read %+v", operation, readOperation)
+		}
+	}
+
+	if len(res.Debug.Events) != len(events) {
+		t.Fatalf("expected %d events, read %d", len(res.Debug.Events), len(events))
+	}
+	for i, event := range res.Debug.Events {
+		if event.Sequence != events[i].Sequence || event.OperationID != events[i].OperationID || event.TransactionID != events[i].TransactionID || event.RunningBalance != events[i].RunningBalance || event.RunningHeld != events[i].RunningHeld {
+			t.Errorf("expected event %+v, read %+v", event, events[i])
+		}
+	}
+}
+
+func TestHandleExecuteOperationsActiveHoldsLimit(t *testing.T) {
+	defer func(tenantConfigs map[string]TenantConfig) {
+		config.TenantConfigs = tenantConfigs
+	}(config.TenantConfigs)
+	config.TenantConfigs = map[string]TenantConfig{testTenant: {MaxActiveHoldsPerAccount: 2}}
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 1000))
+
+	hold := func(transactionID uint64, operations ...operationRequest) *httptest.ResponseRecorder {
+		return testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+			AccountID:     account.AccountID,
+			Tenant:        testTenant,
+			TransactionID: transactionID,
+			Operations:    operations,
+		})
+	}
+
+	// up to the limit
+	first := testPlay(t, pool, account.AccountID, op("HOLD", 10))
+	testPlay(t, pool, account.AccountID, op("HOLD", 10))
+
+	// one past it
+	w := hold(0, op("HOLD", 10))
+	if w.Code != config.BusinessRejectionStatus {
+		t.Fatalf("expected status %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"TOO_MANY_ACTIVE_HOLDS"`) {
+		t.Errorf("expected code TOO_MANY_ACTIVE_HOLDS, got %s", w.Body.String())
+	}
+	// a second hold on a transaction already holding is one more too
+	if w := hold(first.Transaction.TransactionID, op("HOLD", 10)); w.Code != config.BusinessRejectionStatus {
+		t.Errorf("expected status %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+	}
+
+	// released, the first no longer counts
+	testPlayOnTransaction(t, pool, account.AccountID, first.Transaction.TransactionID, op("RELEASE", 10))
+	testPlay(t, pool, account.AccountID, op("HOLD", 10))
+
+	if got := testGetAccount(t, pool, account.AccountID); got.RunningHeld != 20 {
+		t.Errorf("expected 20 held, got %d", got.RunningHeld)
+	}
+}
+
+func TestCheckEventSequences(t *testing.T) {
+	defer func(strictEventSequences bool) {
+		config.StrictEventSequences = strictEventSequences
+	}(config.StrictEventSequences)
+	account := Account{LastPlayedSequence: 4}
+
+	tests := []struct {
+		name      string
+		strict    bool
+		sequences []int64
+		expected  error
+	}{
+		{name: "following on", strict: true, sequences: []int64{5, 6, 7}},
+		{name: "reused", strict: true, sequences: []int64{4}, expected: ErrEventSequenceGap},
+		{name: "repeated", strict: true, sequences: []int64{5, 5}, expected: ErrEventSequenceGap},
+		{name: "skipped", strict: true, sequences: []int64{5, 7}, expected: ErrEventSequenceGap},
+		{name: "not strict", strict: false, sequences: []int64{5, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.StrictEventSequences = tt.strict
+			events := make([]Event, len(tt.sequences))
+			for i := range tt.sequences {
+				events[i].Sequence = tt.sequences[i]
+			}
+
+			if err := checkEventSequences(account, events); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestBatchInsertOperationsAndEventsDuplicateSequence(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+
+	tx, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	// the next operation of the transaction, recorded
+	// at the account's sequence its credit already has
+	operations := []Operation{{OperationType: "CREDIT", AmountInCents: 100, Sequence: 2}}
+	events := []Event{{Sequence: 1, RunningBalance: 200, SchemaVersion: eventSchemaVersion}}
+	_, err = BatchInsertOperationsAndEventsWithContext(context.Background(), tx, played.Transaction, operations, events)
+	if !errors.Is(err, ErrDuplicateSequence) {
+		t.Fatalf("expected %v, got %v", ErrDuplicateSequence, err)
+	}
+	if code := errorCode(http.StatusInternalServerError, err); code != "DUPLICATE_SEQUENCE" {
+		t.Errorf("expected code DUPLICATE_SEQUENCE, got %s", code)
+	}
+}
+
+func TestHandleExecuteOperationsConcurrentPlaysSerialize(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	const plays = 10
+
+	var wg sync.WaitGroup
+	codes := make([]int, plays)
+	for i := 0; i < plays; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+				AccountID:  account.AccountID,
+				Tenant:     testTenant,
+				Operations: []operationRequest{op("CREDIT", 10)},
+			})
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	played := int64(0)
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			played++
+		case http.StatusServiceUnavailable, http.StatusConflict:
+			// gave up retrying, nothing was played
+		default:
+			t.Errorf("expected the play to succeed or be retryable, got %d", code)
+		}
+	}
+	if played == 0 {
+		t.Fatalf("expected some of the plays to succeed, got %v", codes)
+	}
+	// none lost, each played after the one before it
+	got := testGetAccount(t, pool, account.AccountID)
+	if got.RunningBalance != 10*played || got.LastPlayedSequence != played {
+		t.Errorf("expected %d played, got balance %d at sequence %d", played, got.RunningBalance, got.LastPlayedSequence)
+	}
+}
+
+// BenchmarkHandleExecuteOperationsContention plays new transactions
+// concurrently on a handful of accounts, as the load tester does with
+// its account contention, so plays queue on each other's account locks
+// while inserting rows that reference the locked accounts. compare runs
+// across changes to LockAccountWithContext's lock, e.g. with benchstat.
+func BenchmarkHandleExecuteOperationsContention(b *testing.B) {
+	defer func(gate *AccountGate) {
+		accountGate = gate
+	}(accountGate)
+	// the contention would otherwise be turned away before the locks
+	accountGate = NewAccountGate(0)
+	pool := testPool(b)
+	const accounts = 4
+	accountIDs := make([]uint64, accounts)
+	for i := range accountIDs {
+		accountIDs[i] = testAccount(b, pool).AccountID
+	}
+
+	var next uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := testRequest(b, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+				AccountID:  accountIDs[atomic.AddUint64(&next, 1)%accounts],
+				Tenant:     testTenant,
+				Operations: []operationRequest{op("CREDIT", 10)},
+			})
+			switch w.Code {
+			case http.StatusOK, http.StatusServiceUnavailable, http.StatusConflict:
+			default:
+				b.Errorf("expected the play to succeed or be retryable, got %d: %s", w.Code, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestLockAccountBlocksOnlyTheAccount(t *testing.T) {
+	pool := testPool(t)
+	locked := testAccount(t, pool)
+	other := testAccount(t, pool)
+
+	holder, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer holder.Rollback()
+	if _, err := LockAccountWithContext(context.Background(), holder, locked.AccountID); err != nil {
+		t.Fatalf("error locking account: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		accountID uint64
+		lock      func(context.Context, *sql.Tx, uint64) (Account, error)
+		blocks    bool
+	}{
+		{name: "locking the locked account", accountID: locked.AccountID, lock: LockAccountWithContext, blocks: true},
+		{name: "locking another account", accountID: other.AccountID, lock: LockAccountWithContext, blocks: false},
+		{name: "reading the locked account", accountID: locked.AccountID, lock: GetAccountWithContext, blocks: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			tx, err := pool.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatalf("error beginning transaction: %s", err)
+			}
+			defer tx.Rollback()
+
+			_, err = tt.lock(ctx, tx, tt.accountID)
+			if blocked := err != nil && ctx.Err() != nil; blocked != tt.blocks {
+				t.Errorf("expected blocked %t, got %t: %v", tt.blocks, blocked, err)
+			}
+			if !tt.blocks && err != nil {
+				t.Errorf("expected the account, got %s", err)
+			}
+		})
+	}
+}
+
+func TestHandleExecuteOperationsTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		config.Timeouts.ExecuteOperations = timeout
+	}(config.Timeouts.ExecuteOperations)
+	config.Timeouts.ExecuteOperations = 200 * time.Millisecond
+	pool := testPool(t)
+	account := testAccount(t, pool)
+
+	// the play waits on the account's lock until it times out
+	holder, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer holder.Rollback()
+	if _, err := LockAccountWithContext(context.Background(), holder, account.AccountID); err != nil {
+		t.Fatalf("error locking account: %s", err)
+	}
+
+	start := time.Now()
+	w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+		AccountID:  account.AccountID,
+		Tenant:     testTenant,
+		Operations: []operationRequest{op("CREDIT", 100)},
+	})
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed < config.Timeouts.ExecuteOperations || elapsed > 10*config.Timeouts.ExecuteOperations {
+		t.Errorf("expected to time out after %s, took %s", config.Timeouts.ExecuteOperations, elapsed)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// events are flushed to the client in batches of this many
+const exportAccountFlushEvery = 100
+
+// each line of an export is one of these, the account first and then
+// each of its events, a complete export ending with a streamEndRecord
+type accountExportRecord struct {
+	Account *Account `json:"account,omitempty"`
+	Event   *Event   `json:"event,omitempty"`
+}
+
+// HandleExportAccountWithContext streams the account and its complete event
+// log as NDJSON, all read in a single snapshot so the events always add up
+// to the account's balances. after_sequence resumes an export cut short from
+// the last event received, the account is always sent again. the client going
+// away stops the query. once streaming has started errors can't change the
+// status, the export just ends early, without the {"complete":true} record
+// that otherwise ends it.
+func HandleExportAccountWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received export account request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	var afterSequence int64
+	if value := r.URL.Query().Get("after_sequence"); value != "" {
+		afterSequence, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || afterSequence < 0 {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid after_sequence parameter"))
+			return
+		}
+	}
+
+	ctx, cancel := cancelWhenClientGone(ctx, r)
+	defer cancel()
+
+	logger.Infow("handling export account request", "account_id", accountID, "after_sequence", afterSequence)
+	tx, err := pool.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		logger.Errorf("error beginning export account transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing export account database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	extendWriteDeadline(r)
+	if err := encoder.Encode(accountExportRecord{Account: &account}); err != nil {
+		logger.Errorf("error writing export account response: %s", err.Error())
+		return
+	}
+	exported := 0
+	err = StreamAccountEventsWithContext(ctx, tx, accountID, afterSequence, func(event Event) error {
+		extendWriteDeadline(r)
+		if err := encoder.Encode(accountExportRecord{Event: &event}); err != nil {
+			return err
+		}
+		exported++
+		if flusher != nil && exported%exportAccountFlushEvery == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+	if err == nil {
+		extendWriteDeadline(r)
+		err = encoder.Encode(streamEndRecord{Complete: true})
+	}
+	if err != nil {
+		logger.Errorw("export account ended early", "account_id", accountID, "after_sequence", afterSequence, "events", exported, "error", err.Error())
+		return
+	}
+	logger.Infow("account exported", "account_id", accountID, "after_sequence", afterSequence, "events", exported)
+}
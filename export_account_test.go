@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleExportAccountEndsWithCompleteRecord(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 40))
+
+	tests := []struct {
+		name          string
+		afterSequence int64
+		events        int
+	}{
+		{name: "whole export", afterSequence: 0, events: 2},
+		{name: "resumed export", afterSequence: 1, events: 1},
+		{name: "resumed past the end", afterSequence: 2, events: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/export_account?account_id=%d&after_sequence=%d", account.AccountID, tt.afterSequence)
+			w := testRequest(t, HandleExportAccountWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			// the account, its events, then the end record
+			lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+			if len(lines) != tt.events+2 {
+				t.Fatalf("expected %d lines, got %d: %s", tt.events+2, len(lines), w.Body.String())
+			}
+			var end streamEndRecord
+			if err := json.Unmarshal(lines[len(lines)-1], &end); err != nil || !end.Complete {
+				t.Errorf("expected the export to end with a complete record, got %s", lines[len(lines)-1])
+			}
+		})
+	}
+}
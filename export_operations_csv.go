@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// rows are flushed to the client in batches of this many
+const operationsCSVFlushEvery = 100
+
+var operationsCSVHeader = []string{"transaction_id", "operation_id", "operation_type", "amount_in_cents", "sequence"}
+
+// the trailer telling whether the CSV was sent in full, "true" only once
+// the last row has been. a CSV without it was cut short, however it ended
+const exportCompleteTrailer = "X-Export-Complete"
+
+// HandleExportOperationsCSVWithContext streams the operations of an account's
+// transactions within a tenant as a CSV download, a row per operation ordered
+// by transaction and then by sequence, written as they're read. the client
+// going away stops the query. once streaming has started errors can't change
+// the status, the CSV just ends early, without the X-Export-Complete trailer
+// being "true". after_transaction_id and after_sequence resume a CSV cut
+// short from the last row received, the header is always sent again.
+func HandleExportOperationsCSVWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received export operations csv request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
+		return
+	}
+
+	// resuming needs both, the sequence is only unique within the transaction
+	var afterTransactionID uint64
+	var afterSequence int64
+	afterTransactionIDValue, afterSequenceValue := r.URL.Query().Get("after_transaction_id"), r.URL.Query().Get("after_sequence")
+	if afterTransactionIDValue != "" || afterSequenceValue != "" {
+		afterTransactionID, err = strconv.ParseUint(afterTransactionIDValue, 10, 64)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid after_transaction_id parameter"))
+			return
+		}
+		afterSequence, err = strconv.ParseInt(afterSequenceValue, 10, 64)
+		if err != nil || afterSequence < 0 {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid after_sequence parameter"))
+			return
+		}
+	}
+
+	ctx, cancel := cancelWhenClientGone(ctx, r)
+	defer cancel()
+
+	logger.Infow("handling export operations csv request", "account_id", accountID, "tenant", tenant, "after_transaction_id", afterTransactionID, "after_sequence", afterSequence)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning export operations csv transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	if _, err := GetAccountWithContext(ctx, tx, accountID); errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	} else if err != nil {
+		logger.Errorf("error executing export operations csv database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account_%d_operations.csv"`, accountID))
+	w.Header().Set("Trailer", exportCompleteTrailer)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+	extendWriteDeadline(r)
+	if err := writer.Write(operationsCSVHeader); err != nil {
+		logger.Errorf("error writing export operations csv response: %s", err.Error())
+		return
+	}
+	exported := 0
+	err = StreamAccountOperationsWithContext(ctx, tx, accountID, tenant, afterTransactionID, afterSequence, func(operation Operation) error {
+		extendWriteDeadline(r)
+		if err := writer.Write([]string{
+			strconv.FormatUint(operation.TransactionID, 10),
+			strconv.FormatUint(operation.OperationID, 10),
+			operation.OperationType,
+			strconv.FormatInt(operation.AmountInCents, 10),
+			strconv.FormatInt(operation.Sequence, 10),
+		}); err != nil {
+			return err
+		}
+		exported++
+		if exported%operationsCSVFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return writer.Error()
+		}
+
+		return nil
+	})
+	extendWriteDeadline(r)
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		w.Header().Set(exportCompleteTrailer, "false")
+		logger.Errorw("export operations csv ended early", "account_id", accountID, "tenant", tenant, "after_transaction_id", afterTransactionID, "after_sequence", afterSequence, "operations", exported, "error", err.Error())
+		return
+	}
+	w.Header().Set(exportCompleteTrailer, "true")
+	logger.Infow("operations exported as csv", "account_id", accountID, "tenant", tenant, "after_transaction_id", afterTransactionID, "after_sequence", afterSequence, "operations", exported)
+}
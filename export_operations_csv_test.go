@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleExportOperationsCSVInvalidCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "sequence without transaction", query: "after_sequence=1"},
+		{name: "transaction without sequence", query: "after_transaction_id=1"},
+		{name: "negative sequence", query: "after_transaction_id=1&after_sequence=-1"},
+		{name: "invalid transaction", query: "after_transaction_id=abc&after_sequence=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// rejected before the pool is used
+			w := testRequest(t, HandleExportOperationsCSVWithContext, nil, http.MethodGet, "/export_operations_csv?account_id=1&tenant=test&"+tt.query, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleExportOperationsCSVResume(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	first := testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 40))
+	second := testPlay(t, pool, account.AccountID, op("CREDIT", 10))
+
+	tests := []struct {
+		name   string
+		cursor string
+		rows   int
+	}{
+		{name: "whole export", rows: 3},
+		{name: "resumed within a transaction", cursor: fmt.Sprintf("&after_transaction_id=%d&after_sequence=1", first.Transaction.TransactionID), rows: 2},
+		{name: "resumed after a transaction", cursor: fmt.Sprintf("&after_transaction_id=%d&after_sequence=2", first.Transaction.TransactionID), rows: 1},
+		{name: "resumed past the end", cursor: fmt.Sprintf("&after_transaction_id=%d&after_sequence=1", second.Transaction.TransactionID), rows: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/export_operations_csv?account_id=%d&tenant=%s%s", account.AccountID, testTenant, tt.cursor)
+			w := testRequest(t, HandleExportOperationsCSVWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			records, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("error reading csv: %s", err)
+			}
+			// the header is always sent
+			if len(records) != tt.rows+1 {
+				t.Errorf("expected %d rows, got %d", tt.rows, len(records)-1)
+			}
+			if complete := w.Result().Trailer.Get(exportCompleteTrailer); complete != "true" {
+				t.Errorf("expected the %s trailer to be true, got %q", exportCompleteTrailer, complete)
+			}
+		})
+	}
+}
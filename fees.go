@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// FeeSchedule is what a tenant charges for an operation
+// of a given type, charged as a DEBIT played right after it.
+type FeeSchedule struct {
+	FlatInCents int64 `json:"flat_in_cents"`
+	// hundredths of a percent of the operation's amount, rounded down
+	BasisPoints int64 `json:"basis_points"`
+}
+
+type feeMetadata struct {
+	Fee struct {
+		OperationType string `json:"operation_type"`
+		AmountInCents int64  `json:"amount_in_cents"`
+		FeeSchedule
+	} `json:"fee"`
+}
+
+// FeeInCents returns the fee charged for an operation of the given amount.
+func (f FeeSchedule) FeeInCents(amountInCents int64) (int64, error) {
+	if f.BasisPoints > 0 && amountInCents > math.MaxInt64/f.BasisPoints {
+		return 0, ErrAmountOverflow
+	}
+
+	fee, ok := addInt64(f.FlatInCents, amountInCents*f.BasisPoints/10000)
+	if !ok {
+		return 0, ErrAmountOverflow
+	}
+
+	return fee, nil
+}
+
+// operationsWithFees returns the operations with the fee, if the
+// tenant charges one, played right after each operation it's for,
+// so an operation and its fee are applied atomically.
+func operationsWithFees(tenant string, operations []Operation) ([]Operation, error) {
+	fees := config.TenantConfig(tenant).Fees
+	if len(fees) == 0 {
+		return operations, nil
+	}
+
+	operationsWithFees := make([]Operation, 0, len(operations))
+	for i := range operations {
+		operationsWithFees = append(operationsWithFees, operations[i])
+
+		feeSchedule, ok := fees[operations[i].OperationType]
+		if !ok {
+			continue
+		}
+		fee, err := feeSchedule.FeeInCents(operations[i].AmountInCents)
+		if err != nil {
+			return nil, fmt.Errorf("error computing fee: %w", err)
+		}
+		if fee == 0 {
+			continue
+		}
+
+		var metadata feeMetadata
+		metadata.Fee.OperationType = operations[i].OperationType
+		metadata.Fee.AmountInCents = operations[i].AmountInCents
+		metadata.Fee.FeeSchedule = feeSchedule
+		marshaledMetadata, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling metadata: %w", err)
+		}
+
+		operationsWithFees = append(operationsWithFees, Operation{OperationType: "DEBIT", AmountInCents: fee, Metadata: marshaledMetadata, fee: true})
+	}
+
+	return operationsWithFees, nil
+}
+
+// feeOperations returns the played operations that are fees.
+func feeOperations(operations []Operation) []Operation {
+	var fees []Operation
+	for i := range operations {
+		if operations[i].fee {
+			fees = append(fees, operations[i])
+		}
+	}
+
+	return fees
+}
+
+// isFeeOperation reports whether a recorded operation is a fee,
+// which operations read back only tell apart by their metadata.
+func isFeeOperation(operation Operation) bool {
+	var metadata feeMetadata
+	if err := json.Unmarshal(operation.Metadata, &metadata); err != nil {
+		return false
+	}
+
+	return metadata.Fee.OperationType != ""
+}
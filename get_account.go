@@ -4,12 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strconv"
+	"time"
 )
 
+// the longest balance trend get_account will return
+const maxBalanceTrendLength = 100
+
+type balanceTrendPoint struct {
+	Sequence       int64     `json:"sequence"`
+	RunningBalance int64     `json:"running_balance"`
+	Created        time.Time `json:"created"`
+}
+
+type getAccountResponse struct {
+	Account
+	// only present when asked for with include_trend
+	Trend []balanceTrendPoint `json:"trend,omitempty"`
+}
+
 func HandleGetAccountWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
 	defer logger.Sync()
 	logger.Info("received get account request")
@@ -18,8 +35,16 @@ func HandleGetAccountWithContext(ctx context.Context, pool *sql.DB, w http.Respo
 		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing/invalid account_id parameter"))
 		return
 	}
+	var trendLength int
+	if includeTrend := r.URL.Query().Get("include_trend"); includeTrend != "" {
+		trendLength, err = strconv.Atoi(includeTrend)
+		if err != nil || trendLength <= 0 || trendLength > maxBalanceTrendLength {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid include_trend parameter, must be between 1 and %d", maxBalanceTrendLength))
+			return
+		}
+	}
 
-	tx, err := pool.BeginTx(ctx, nil)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
 	if err != nil {
 		logger.Errorf("error beginning get account transaction: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
@@ -31,6 +56,10 @@ func HandleGetAccountWithContext(ctx context.Context, pool *sql.DB, w http.Respo
 
 	logger.Infow("handling get account request", "account_id", accountID)
 	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
 	if err != nil {
 		logger.Errorf("error executing get account database operations: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
@@ -38,6 +67,26 @@ func HandleGetAccountWithContext(ctx context.Context, pool *sql.DB, w http.Respo
 		return
 	}
 
+	result := getAccountResponse{Account: account}
+	if trendLength > 0 {
+		// same transaction, so the trend ends at the returned balance
+		events, err := GetRecentEventsWithContext(ctx, tx, accountID, trendLength)
+		if err != nil {
+			logger.Errorf("error executing get account database operations: %s", err.Error())
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+			debug.PrintStack()
+			return
+		}
+		result.Trend = make([]balanceTrendPoint, len(events))
+		for i := range events {
+			result.Trend[i] = balanceTrendPoint{
+				Sequence:       events[i].Sequence,
+				RunningBalance: events[i].RunningBalance,
+				Created:        events[i].Created,
+			}
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		logger.Errorf("error committing get account transaction: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
@@ -45,14 +94,14 @@ func HandleGetAccountWithContext(ctx context.Context, pool *sql.DB, w http.Respo
 		return
 	}
 
-	marshaledAccount, err := json.Marshal(account)
+	marshaledAccount, err := json.Marshal(result)
 	if err != nil {
 		logger.Errorf("error marshaling get account response: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
 		debug.PrintStack()
 		return
 	}
-	logger.Infow("account fetched", "account_id", accountID, "account", account)
+	logger.Infow("account fetched", "account_id", accountID, "account", redacted(result))
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(marshaledAccount)
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// all null for accounts nothing has been played on yet
+type getAccountActivityResponse struct {
+	AccountID        uint64     `json:"account_id"`
+	Tenant           string     `json:"tenant,omitempty"`
+	FirstOperationAt *time.Time `json:"first_operation_at"`
+	LastOperationAt  *time.Time `json:"last_operation_at"`
+	ElapsedInMs      *int64     `json:"elapsed_in_ms"`
+}
+
+// HandleGetAccountActivityWithContext reports when the first and last
+// operations were played on an account, to tell dormant accounts from
+// active ones. accounts that don't exist look like ones without operations.
+func HandleGetAccountActivityWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account activity request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	// optional, all tenants when absent
+	tenant := r.URL.Query().Get("tenant")
+
+	logger.Infow("handling get account activity request", "account_id", accountID, "tenant", tenant)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account activity transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	first, last, err := GetAccountActivityWithContext(ctx, tx, accountID, tenant)
+	if err != nil {
+		logger.Errorf("error executing get account activity database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account activity transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getAccountActivityResponse{AccountID: accountID, Tenant: tenant}
+	// both are set or neither is
+	if first.Valid && last.Valid {
+		elapsed := last.Time.Sub(first.Time).Milliseconds()
+		result.FirstOperationAt = &first.Time
+		result.LastOperationAt = &last.Time
+		result.ElapsedInMs = &elapsed
+	}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get account activity response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account activity fetched", "account_id", accountID, "tenant", tenant, "result", result)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+type getAccountBalanceResponse struct {
+	AccountID      uint64    `json:"account_id"`
+	AsOfTime       time.Time `json:"as_of_time"`
+	Sequence       int64     `json:"sequence"`
+	RunningBalance int64     `json:"running_balance"`
+	RunningHeld    int64     `json:"running_held"`
+}
+
+func HandleGetAccountBalanceWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account balance request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	asOfTime, err := time.Parse(time.RFC3339, r.URL.Query().Get("as_of_time"))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid as_of_time parameter"))
+		return
+	}
+
+	logger.Infow("handling get account balance request", "account_id", accountID, "as_of_time", asOfTime)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account balance transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get account balance database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getAccountBalanceResponse{
+		AccountID:      accountID,
+		AsOfTime:       asOfTime,
+		Sequence:       account.LastPlayedSequence,
+		RunningBalance: account.RunningBalance,
+		RunningHeld:    account.RunningHeld,
+	}
+	// nothing can have happened since, so the current balance stands
+	if asOfTime.Before(time.Now()) {
+		created, err := GetAccountCreatedWithContext(ctx, tx, accountID)
+		if err != nil {
+			logger.Errorf("error executing get account balance database operations: %s", err.Error())
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+			debug.PrintStack()
+			return
+		}
+		// when it's unknown, so is whether the account existed
+		// then, and it's answered as if it had, with no events yet
+		if created.Valid && asOfTime.Before(created.Time) {
+			writeHTTPError(w, http.StatusUnprocessableEntity, errors.New("error as_of_time predates the account"))
+			return
+		}
+
+		event, err := GetEventAsOfTimeWithContext(ctx, tx, accountID, asOfTime)
+		// the account existed but hadn't been played against yet
+		if errors.Is(err, ErrNotFound) {
+			event = Event{}
+			err = nil
+		}
+		if err != nil {
+			logger.Errorf("error executing get account balance database operations: %s", err.Error())
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+			debug.PrintStack()
+			return
+		}
+		result.Sequence = event.Sequence
+		result.RunningBalance = event.RunningBalance
+		result.RunningHeld = event.RunningHeld
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account balance transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get account balance response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account balance fetched", "account_id", accountID, "as_of_time", asOfTime, "result", redacted(result))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
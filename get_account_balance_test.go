@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHandleGetAccountBalanceCreated(t *testing.T) {
+	pool := testPool(t)
+	asOfTime := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		created    interface{}
+		statusCode int
+	}{
+		{name: "created before", created: asOfTime.Add(-time.Hour), statusCode: http.StatusOK},
+		{name: "created after", created: asOfTime.Add(time.Hour), statusCode: http.StatusUnprocessableEntity},
+		// the account may have existed then, it's not rejected
+		{name: "created unknown", created: nil, statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testAccount(t, pool)
+			testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+			if _, err := pool.ExecContext(context.Background(), "UPDATE accounts SET created = $2 WHERE account_id = $1", account.AccountID, tt.created); err != nil {
+				t.Fatalf("error setting created: %s", err)
+			}
+
+			target := fmt.Sprintf("/get_account_balance?account_id=%d&as_of_time=%s", account.AccountID, url.QueryEscape(asOfTime.Format(time.RFC3339)))
+			w := testRequest(t, HandleGetAccountBalanceWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			// the credit came after
+			var res getAccountBalanceResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if res.RunningBalance != 0 || res.Sequence != 0 {
+				t.Errorf("expected no balance as of then, got %d at sequence %d", res.RunningBalance, res.Sequence)
+			}
+		})
+	}
+}
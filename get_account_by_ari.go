@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+func HandleGetAccountByARIWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account by ari request")
+	userARI := r.URL.Query().Get("user_ari")
+	if userARI == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing user_ari parameter"))
+		return
+	}
+
+	// the user_ari itself isn't logged, it may be redacted
+	logger.Infow("handling get account by ari request", "request", redacted(map[string]string{"user_ari": userARI}))
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account by ari transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := GetAccountByUserARIWithContext(ctx, tx, userARI)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get account by ari database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account by ari transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledAccount, err := json.Marshal(account)
+	if err != nil {
+		logger.Errorf("error marshaling get account by ari response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account fetched by ari", "account_id", account.AccountID, "account", redacted(account))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledAccount)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+const (
+	defaultOperationRateWindowInMinutes = 5
+	maxOperationRateWindowInMinutes     = 24 * 60
+)
+
+type getAccountOperationRateResponse struct {
+	AccountID           uint64  `json:"account_id"`
+	Tenant              string  `json:"tenant,omitempty"`
+	WindowInMinutes     int     `json:"window_in_minutes"`
+	Operations          int64   `json:"operations"`
+	OperationsPerMinute float64 `json:"operations_per_minute"`
+}
+
+// HandleGetAccountOperationRateWithContext reports how many operations
+// were played on an account per minute over the recent window, to spot
+// hot accounts as they happen. idle accounts, and accounts that don't
+// exist, have a rate of zero.
+func HandleGetAccountOperationRateWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account operation rate request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	// optional, all tenants when absent
+	tenant := r.URL.Query().Get("tenant")
+	windowInMinutes := defaultOperationRateWindowInMinutes
+	if value := r.URL.Query().Get("window_in_minutes"); value != "" {
+		windowInMinutes, err = strconv.Atoi(value)
+		if err != nil || windowInMinutes <= 0 || windowInMinutes > maxOperationRateWindowInMinutes {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid window_in_minutes parameter, must be between 1 and %d", maxOperationRateWindowInMinutes))
+			return
+		}
+	}
+
+	logger.Infow("handling get account operation rate request", "account_id", accountID, "tenant", tenant, "window_in_minutes", windowInMinutes)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account operation rate transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	operations, err := CountRecentAccountOperationsWithContext(ctx, tx, accountID, tenant, windowInMinutes)
+	if err != nil {
+		logger.Errorf("error executing get account operation rate database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account operation rate transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getAccountOperationRateResponse{
+		AccountID:           accountID,
+		Tenant:              tenant,
+		WindowInMinutes:     windowInMinutes,
+		Operations:          operations,
+		OperationsPerMinute: float64(operations) / float64(windowInMinutes),
+	}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get account operation rate response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account operation rate fetched", "account_id", accountID, "tenant", tenant, "result", result)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+type getAccountPositionsResponse struct {
+	Account   Account          `json:"account"`
+	Positions []TenantPosition `json:"positions"`
+}
+
+func HandleGetAccountPositionsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account positions request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+
+	logger.Infow("handling get account positions request", "account_id", accountID)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account positions transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	// read in the same transaction so the positions
+	// add up to the returned RunningBalance
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get account positions database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	positions, err := GetTenantPositionsWithContext(ctx, tx, accountID)
+	if err != nil {
+		logger.Errorf("error executing get account positions database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account positions transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	var balance int64
+	for i := range positions {
+		balance += positions[i].BalanceInCents
+	}
+	if balance != account.RunningBalance {
+		logger.Errorw("tenant positions don't add up to the account's running balance, triage needed", "account_id", accountID, "positions_balance", balance, "running_balance", account.RunningBalance)
+	}
+
+	result := getAccountPositionsResponse{Account: account, Positions: positions}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get account positions response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account positions fetched", "account_id", accountID, "result", redacted(result))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleGetAccountPositionsSumToBalance(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 1000), op("DEBIT", 150))
+	testPlay(t, pool, account.AccountID, op("HOLD", 200), op("SETTLE", 50))
+	// another tenant's transaction on the same account
+	otherTenant := testTenant + "-other"
+	w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+		AccountID:  account.AccountID,
+		Tenant:     otherTenant,
+		Operations: []operationRequest{op("CREDIT", 300), op("HOLD", 75)},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected operations to be played, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = testRequest(t, HandleGetAccountPositionsWithContext, pool, http.MethodGet, fmt.Sprintf("/get_account_positions?account_id=%d", account.AccountID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res getAccountPositionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+
+	if len(res.Positions) != 2 {
+		t.Fatalf("expected a position for each of the 2 tenants, got %d", len(res.Positions))
+	}
+	var balance, held int64
+	for _, position := range res.Positions {
+		balance += position.BalanceInCents
+		held += position.HeldAmountInCents
+	}
+	if balance != res.Account.RunningBalance {
+		t.Errorf("expected positions to sum to the running balance %d, got %d", res.Account.RunningBalance, balance)
+	}
+	if held != res.Account.RunningHeld {
+		t.Errorf("expected positions to sum to the running held %d, got %d", res.Account.RunningHeld, held)
+	}
+	// and to what was played
+	if res.Account.RunningBalance != 1000-150-200+300-75 {
+		t.Errorf("expected running balance %d, got %d", 1000-150-200+300-75, res.Account.RunningBalance)
+	}
+}
+
+func TestHandleGetAccountPositionsNotFound(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+
+	w := testRequest(t, HandleGetAccountPositionsWithContext, pool, http.MethodGet, fmt.Sprintf("/get_account_positions?account_id=%d", account.AccountID+1<<40), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+type AccountSnapshot struct {
+	AccountID          uint64    `json:"account_id"`
+	RunningBalance     int64     `json:"running_balance"`
+	RunningHeld        int64     `json:"running_held"`
+	LastPlayedSequence int64     `json:"last_played_sequence"`
+	AsOf               time.Time `json:"as_of"`
+}
+
+type signedAccountSnapshot struct {
+	Snapshot  AccountSnapshot `json:"snapshot"`
+	Signature string          `json:"signature"`
+}
+
+// HandleGetAccountSnapshotWithContext returns the account's current state
+// signed with the snapshot signing key, so that third parties holding the
+// key can verify a balance without access to the database.
+func HandleGetAccountSnapshotWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get account snapshot request")
+	if config.SnapshotSigningKey == "" {
+		writeHTTPError(w, http.StatusForbidden, errors.New("error account snapshots are disabled"))
+		return
+	}
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+
+	logger.Infow("handling get account snapshot request", "account_id", accountID)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get account snapshot transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get account snapshot database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get account snapshot transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	snapshot := AccountSnapshot{
+		AccountID:          account.AccountID,
+		RunningBalance:     account.RunningBalance,
+		RunningHeld:        account.RunningHeld,
+		LastPlayedSequence: account.LastPlayedSequence,
+		AsOf:               time.Now().UTC().Truncate(time.Second),
+	}
+	result := signedAccountSnapshot{
+		Snapshot:  snapshot,
+		Signature: SignAccountSnapshot([]byte(config.SnapshotSigningKey), snapshot),
+	}
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get account snapshot response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("account snapshot fetched", "account_id", accountID, "snapshot", snapshot)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// SignAccountSnapshot returns the hex encoded HMAC-SHA256, keyed with
+// the given key, of the snapshot's account id, running balance, running
+// held, last played sequence and as of time (unix seconds), in that
+// order, each formatted in base 10 and separated by a newline.
+func SignAccountSnapshot(key []byte, snapshot AccountSnapshot) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d\n%d\n%d\n%d\n%d",
+		snapshot.AccountID,
+		snapshot.RunningBalance,
+		snapshot.RunningHeld,
+		snapshot.LastPlayedSequence,
+		snapshot.AsOf.Unix(),
+	)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAccountSnapshot reports whether the signature
+// was made over the snapshot with the given key.
+func VerifyAccountSnapshot(key []byte, snapshot AccountSnapshot, signature string) bool {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(SignAccountSnapshot(key, snapshot))
+
+	return hmac.Equal(decoded, expected)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleGetAccountTrend(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("CREDIT", 200), op("DEBIT", 50))
+	testPlay(t, pool, account.AccountID, op("CREDIT", 25))
+
+	tests := []struct {
+		name              string
+		trendLength       int
+		expectedSequences []int64
+		expectedBalances  []int64
+	}{
+		{name: "shorter than the events", trendLength: 2, expectedSequences: []int64{3, 4}, expectedBalances: []int64{250, 275}},
+		{name: "as long as the events", trendLength: 4, expectedSequences: []int64{1, 2, 3, 4}, expectedBalances: []int64{100, 300, 250, 275}},
+		{name: "longer than the events", trendLength: 10, expectedSequences: []int64{1, 2, 3, 4}, expectedBalances: []int64{100, 300, 250, 275}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/get_account?account_id=%d&include_trend=%d", account.AccountID, tt.trendLength)
+			w := testRequest(t, HandleGetAccountWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var res getAccountResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if len(res.Trend) != len(tt.expectedSequences) {
+				t.Fatalf("expected %d points, got %d", len(tt.expectedSequences), len(res.Trend))
+			}
+			for i := range res.Trend {
+				if res.Trend[i].Sequence != tt.expectedSequences[i] || res.Trend[i].RunningBalance != tt.expectedBalances[i] {
+					t.Errorf("expected point %d to be %d at sequence %d, got %d at sequence %d", i, tt.expectedBalances[i], tt.expectedSequences[i], res.Trend[i].RunningBalance, res.Trend[i].Sequence)
+				}
+			}
+			// it ends at the balance returned alongside it
+			last := res.Trend[len(res.Trend)-1]
+			if last.RunningBalance != res.RunningBalance || last.Sequence != res.LastPlayedSequence {
+				t.Errorf("expected the trend to end at %d at sequence %d, got %d at sequence %d", res.RunningBalance, res.LastPlayedSequence, last.RunningBalance, last.Sequence)
+			}
+		})
+	}
+}
+
+func TestHandleGetAccountInvalidTrend(t *testing.T) {
+	tests := []struct {
+		name         string
+		includeTrend string
+	}{
+		{name: "zero", includeTrend: "0"},
+		{name: "negative", includeTrend: "-1"},
+		{name: "past the cap", includeTrend: fmt.Sprint(maxBalanceTrendLength + 1)},
+		{name: "not a number", includeTrend: "many"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// rejected before the pool is used
+			w := testRequest(t, HandleGetAccountWithContext, nil, http.MethodGet, "/get_account?account_id=1&include_trend="+tt.includeTrend, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// the most events get_events will return, the
+// rest can be paged through with from_sequence
+const maxEventsPerRead = 1000
+
+type getEventsResponse struct {
+	Events []Event `json:"events"`
+	// set when there were more events in range than
+	// were returned, page on from the last sequence
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// the response with format=cdc, see cdcEnvelope
+type getEventsCDCResponse struct {
+	Events    []cdcEnvelope `json:"events"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+func HandleGetEventsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get events request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	// optional, all tenants when absent
+	tenant := r.URL.Query().Get("tenant")
+	fromSequence, err := parseOptionalSequenceParameter(r, "from_sequence")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid from_sequence parameter"))
+		return
+	}
+	toSequence, err := parseOptionalSequenceParameter(r, "to_sequence")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid to_sequence parameter"))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = eventsFormatNative
+	}
+	if format != eventsFormatNative && format != eventsFormatCDC {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid format parameter"))
+		return
+	}
+
+	logger.Infow("handling get events request", "account_id", accountID, "tenant", tenant, "from_sequence", fromSequence, "to_sequence", toSequence, "format", format)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get events transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	// one past the limit to detect truncation
+	events, err := GetEventsWithContext(ctx, tx, accountID, tenant, fromSequence, toSequence, maxEventsPerRead+1)
+	if err != nil {
+		logger.Errorf("error executing get events database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get events transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getEventsResponse{Events: events}
+	if len(events) > maxEventsPerRead {
+		result = getEventsResponse{Events: events[:maxEventsPerRead], Truncated: true}
+	}
+	var response interface{} = result
+	if format == eventsFormatCDC {
+		response = getEventsCDCResponse{Events: cdcEnvelopes(result.Events, time.Now().UnixNano()/1e6), Truncated: result.Truncated}
+	}
+	marshaledData, err := json.Marshal(response)
+	if err != nil {
+		logger.Errorf("error marshaling get events response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("events fetched", "account_id", accountID, "tenant", tenant, "count", len(result.Events), "truncated", result.Truncated)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// parseOptionalSequenceParameter reads a sequence number
+// from the query string, returning a null int if absent.
+func parseOptionalSequenceParameter(r *http.Request, name string) (sql.NullInt64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		return sql.NullInt64{}, fmt.Errorf("error parsing sequence parameter: %s", value)
+	}
+
+	return sql.NullInt64{Int64: parsed, Valid: true}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+type getHeldOperationsResponse struct {
+	Account        Account         `json:"account"`
+	HeldOperations []HeldOperation `json:"held_operations"`
+}
+
+func HandleGetHeldOperationsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get held operations request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+
+	logger.Infow("handling get held operations request", "account_id", accountID)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get held operations transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	// read in the same transaction so the held
+	// operations add up to the returned RunningHeld
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if err != nil {
+		logger.Errorf("error executing get held operations database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	operations, err := GetHoldAndReleaseOperationsWithContext(ctx, tx, accountID)
+	if err != nil {
+		logger.Errorf("error executing get held operations database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get held operations transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getHeldOperationsResponse{Account: account, HeldOperations: NetHeldOperations(operations)}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get held operations response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("held operations fetched", "account_id", accountID, "result", redacted(result))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+func HandleGetLargestTransactionWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get largest transaction request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	// optional, all tenants when absent
+	tenant := r.URL.Query().Get("tenant")
+	from, err := parseOptionalTimeParameter(r, "from")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid from parameter"))
+		return
+	}
+	to, err := parseOptionalTimeParameter(r, "to")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid to parameter"))
+		return
+	}
+
+	logger.Infow("handling get largest transaction request", "account_id", accountID, "tenant", tenant, "from", from, "to", to)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get largest transaction transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	transaction, err := GetLargestTransactionWithContext(ctx, tx, accountID, tenant, from, to)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error no transactions found for account"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get largest transaction database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get largest transaction transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(transaction)
+	if err != nil {
+		logger.Errorf("error marshaling get largest transaction response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("largest transaction fetched", "account_id", accountID, "tenant", tenant, "transaction", redacted(transaction))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// parseOptionalTimeParameter reads an RFC3339 timestamp
+// from the query string, returning a null time if absent.
+func parseOptionalTimeParameter(r *http.Request, name string) (sql.NullTime, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("error parsing time parameter: %w", err)
+	}
+
+	return sql.NullTime{Time: parsed, Valid: true}, nil
+}
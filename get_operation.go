@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+func HandleGetOperationWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get operation request")
+	operationID, err := strconv.ParseUint(r.URL.Query().Get("operation_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid operation_id parameter"))
+		return
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
+		return
+	}
+
+	// operations never change once played
+	cacheKey := fmt.Sprintf("%s/%d", tenant, operationID)
+	if cached, ok := responseCache.Get("get_operation", cacheKey); ok {
+		w.WriteHeader(http.StatusOK)
+		w.Write(cached)
+		return
+	}
+
+	logger.Infow("handling get operation request", "operation_id", operationID, "tenant", tenant)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get operation transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	operation, err := GetOperationWithContext(ctx, tx, tenant, operationID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error operation not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get operation database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get operation transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(operation)
+	if err != nil {
+		logger.Errorf("error marshaling get operation response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("operation fetched", "operation_id", operationID, "tenant", tenant, "operation", redacted(operation))
+	responseCache.Add("get_operation", cacheKey, marshaledData)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// what the operations of a chain add up to on the account,
+// zero for both once an operation has been fully reversed
+type reversalChainNetEffect struct {
+	BalanceInCents int64 `json:"balance_in_cents"`
+	HeldInCents    int64 `json:"held_in_cents"`
+}
+
+type getOperationChainResponse struct {
+	Operations []Operation            `json:"operations"`
+	NetEffect  reversalChainNetEffect `json:"net_effect"`
+}
+
+// HandleGetOperationChainWithContext returns the chain of reversals an
+// operation is part of, the original operation and everything reversing
+// it, from any operation in the chain, along with their net effect. an
+// operation that was never reversed is a chain of its own.
+func HandleGetOperationChainWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get operation chain request")
+	operationID, err := strconv.ParseUint(r.URL.Query().Get("operation_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid operation_id parameter"))
+		return
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
+		return
+	}
+
+	logger.Infow("handling get operation chain request", "operation_id", operationID, "tenant", tenant)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get operation chain transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	operations, err := GetOperationReversalChainWithContext(ctx, tx, tenant, operationID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error operation not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get operation chain database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get operation chain transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getOperationChainResponse{Operations: operations, NetEffect: netEffect(operations)}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get operation chain response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("operation chain fetched", "operation_id", operationID, "tenant", tenant, "operations", len(operations), "net_effect", result.NetEffect)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// netEffect adds up what the operations did to the account's
+// balance and held amount, the same way playing them does.
+func netEffect(operations []Operation) reversalChainNetEffect {
+	var effect reversalChainNetEffect
+	for i := range operations {
+		amount := operations[i].AmountInCents
+		switch operations[i].OperationType {
+		case "HOLD":
+			effect.BalanceInCents -= amount
+			effect.HeldInCents += amount
+		case "RELEASE":
+			effect.BalanceInCents += amount
+			effect.HeldInCents -= amount
+		case "SETTLE":
+			effect.HeldInCents -= amount
+		case "DEBIT":
+			effect.BalanceInCents -= amount
+		case "CREDIT":
+			effect.BalanceInCents += amount
+		}
+	}
+
+	return effect
+}
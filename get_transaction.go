@@ -24,9 +24,40 @@ func HandleGetTransactionWithContext(ctx context.Context, pool *sql.DB, w http.R
 		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
 		return
 	}
+	// optional, the transaction as it is now when absent
+	asOfSequence, err := parseOptionalSequenceParameter(r, "as_of_sequence")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid as_of_sequence parameter"))
+		return
+	}
+	// optional, only the operations matching them are returned
+	var filter OperationsFilter
+	filter.OperationType = r.URL.Query().Get("operation_type")
+	if filter.OperationType != "" {
+		if _, err := (Operation{OperationType: filter.OperationType}).Type(); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid operation_type parameter"))
+			return
+		}
+	}
+	filter.SinceSequence, err = parseOptionalSequenceParameter(r, "since_sequence")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid since_sequence parameter"))
+		return
+	}
 
-	logger.Infow("handling get transaction request", "transaction_id", transactionID, "tenant", tenant)
-	tx, err := pool.BeginTx(ctx, nil)
+	// a transaction as of a sequence it has already
+	// played never changes, unlike the transaction now
+	cacheKey := fmt.Sprintf("%s/%d/%d/%s/%d/%t", tenant, transactionID, asOfSequence.Int64, filter.OperationType, filter.SinceSequence.Int64, filter.SinceSequence.Valid)
+	if asOfSequence.Valid {
+		if cached, ok := responseCache.Get("get_transaction", cacheKey); ok {
+			w.WriteHeader(http.StatusOK)
+			w.Write(cached)
+			return
+		}
+	}
+
+	logger.Infow("handling get transaction request", "transaction_id", transactionID, "tenant", tenant, "as_of_sequence", asOfSequence, "filter", filter)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
 	if err != nil {
 		logger.Errorf("error beginning get transaction transaction: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
@@ -37,7 +68,16 @@ func HandleGetTransactionWithContext(ctx context.Context, pool *sql.DB, w http.R
 		tx.Rollback()
 	}()
 
-	result, err := GetTransactionAndOperationsWithContext(ctx, tx, tenant, transactionID)
+	var result TransactionWithOperations
+	if asOfSequence.Valid {
+		result, err = GetTransactionAndOperationsAsOfSequenceWithContext(ctx, tx, tenant, transactionID, asOfSequence.Int64, config.MaxOperationsPerTransactionRead, filter)
+	} else {
+		result, err = GetTransactionAndOperationsWithContext(ctx, tx, tenant, transactionID, config.MaxOperationsPerTransactionRead, filter)
+	}
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error transaction not found"))
+		return
+	}
 	if err != nil {
 		logger.Errorf("error executing get transaction database operations: %s", err.Error())
 		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
@@ -59,7 +99,10 @@ func HandleGetTransactionWithContext(ctx context.Context, pool *sql.DB, w http.R
 		debug.PrintStack()
 		return
 	}
-	logger.Infow("transaction fetched", "transaction_id", transactionID, "tenant", tenant, "transaction", result)
+	logger.Infow("transaction fetched", "transaction_id", transactionID, "tenant", tenant, "transaction", redacted(result))
+	if asOfSequence.Valid && result.Transaction.LastPlayedSequence == asOfSequence.Int64 {
+		responseCache.Add("get_transaction", cacheKey, marshaledData)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(marshaledData)
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+type getBalanceAtSequenceResponse struct {
+	AccountID uint64 `json:"account_id"`
+	// the sequence asked for, and that of the event the
+	// balance is from, the latest one at or before it
+	RequestedSequence int64     `json:"requested_sequence"`
+	Sequence          int64     `json:"sequence"`
+	RunningBalance    int64     `json:"running_balance"`
+	RunningHeld       int64     `json:"running_held"`
+	Created           time.Time `json:"created"`
+}
+
+// HandleGetTransactionBalanceAtSequenceWithContext returns an account's
+// running balance as of one of its sequences, for auditors tracing how
+// it got to where it is. it's a 404 when nothing had been played by then.
+func HandleGetTransactionBalanceAtSequenceWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get transaction balance at sequence request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	sequence, err := strconv.ParseInt(r.URL.Query().Get("sequence"), 10, 64)
+	if err != nil || sequence <= 0 {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid sequence parameter"))
+		return
+	}
+
+	logger.Infow("handling get transaction balance at sequence request", "account_id", accountID, "sequence", sequence)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get transaction balance at sequence transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	event, err := GetBalanceAtSequenceWithContext(ctx, tx, accountID, sequence)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error no event at or before sequence"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing get transaction balance at sequence database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get transaction balance at sequence transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getBalanceAtSequenceResponse{
+		AccountID:         accountID,
+		RequestedSequence: sequence,
+		Sequence:          event.Sequence,
+		RunningBalance:    event.RunningBalance,
+		RunningHeld:       event.RunningHeld,
+		Created:           event.Created,
+	}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get transaction balance at sequence response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("balance at sequence fetched", "account_id", accountID, "sequence", sequence, "result", redacted(result))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
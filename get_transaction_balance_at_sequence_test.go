@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleGetTransactionBalanceAtSequence(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("CREDIT", 200))
+	testPlay(t, pool, account.AccountID, op("HOLD", 50))
+	empty := testAccount(t, pool)
+
+	tests := []struct {
+		name            string
+		accountID       uint64
+		sequence        int64
+		statusCode      int
+		expectedAt      int64
+		expectedBalance int64
+		expectedHeld    int64
+	}{
+		{name: "exactly the first event", accountID: account.AccountID, sequence: 1, statusCode: http.StatusOK, expectedAt: 1, expectedBalance: 100},
+		{name: "exactly a later event", accountID: account.AccountID, sequence: 2, statusCode: http.StatusOK, expectedAt: 2, expectedBalance: 300},
+		{name: "exactly the last event", accountID: account.AccountID, sequence: 3, statusCode: http.StatusOK, expectedAt: 3, expectedBalance: 250, expectedHeld: 50},
+		{name: "past the last event", accountID: account.AccountID, sequence: 4, statusCode: http.StatusOK, expectedAt: 3, expectedBalance: 250, expectedHeld: 50},
+		{name: "before any event", accountID: empty.AccountID, sequence: 1, statusCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/get_transaction_balance_at_sequence?account_id=%d&sequence=%d", tt.accountID, tt.sequence)
+			w := testRequest(t, HandleGetTransactionBalanceAtSequenceWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var res getBalanceAtSequenceResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if res.RequestedSequence != tt.sequence || res.Sequence != tt.expectedAt {
+				t.Errorf("expected the event at %d for sequence %d, got the event at %d for %d", tt.expectedAt, tt.sequence, res.Sequence, res.RequestedSequence)
+			}
+			if res.RunningBalance != tt.expectedBalance || res.RunningHeld != tt.expectedHeld {
+				t.Errorf("expected balance %d and held %d, got %d and %d", tt.expectedBalance, tt.expectedHeld, res.RunningBalance, res.RunningHeld)
+			}
+		})
+	}
+}
+
+func TestHandleGetTransactionBalanceAtSequenceInvalidSequence(t *testing.T) {
+	for _, sequence := range []string{"0", "-1", "first", ""} {
+		t.Run(sequence, func(t *testing.T) {
+			// rejected before the pool is used
+			w := testRequest(t, HandleGetTransactionBalanceAtSequenceWithContext, nil, http.MethodGet, "/get_transaction_balance_at_sequence?account_id=1&sequence="+sequence, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
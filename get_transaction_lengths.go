@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// the upper bound of each bucket of transaction lengths, in
+// operations, the last bucket takes every longer transaction
+var transactionLengthBucketBounds = []int64{1, 5, 10, 50, 100, 1000}
+
+// TransactionLengthBucket counts the transactions with between
+// Min and Max operations, no Max meaning there's no upper bound.
+type TransactionLengthBucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max,omitempty"`
+	Count int64 `json:"count"`
+}
+
+type TenantTransactionLengths struct {
+	Tenant  string                    `json:"tenant"`
+	Buckets []TransactionLengthBucket `json:"buckets"`
+}
+
+type getTransactionLengthsResponse struct {
+	Tenants []TenantTransactionLengths `json:"tenants"`
+}
+
+// HandleGetTransactionLengthsWithContext returns a histogram per tenant
+// of how many operations transactions have, for capacity planning.
+func HandleGetTransactionLengthsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received get transaction lengths request")
+	// optional, all tenants when absent
+	tenant := r.URL.Query().Get("tenant")
+	from, err := parseOptionalTimeParameter(r, "from")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid from parameter"))
+		return
+	}
+	to, err := parseOptionalTimeParameter(r, "to")
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid to parameter"))
+		return
+	}
+
+	logger.Infow("handling get transaction lengths request", "tenant", tenant, "from", from, "to", to)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning get transaction lengths transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	counts, err := GetTransactionLengthCountsWithContext(ctx, tx, tenant, from, to)
+	if err != nil {
+		logger.Errorf("error executing get transaction lengths database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing get transaction lengths transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := getTransactionLengthsResponse{Tenants: bucketTransactionLengths(counts)}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling get transaction lengths response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("transaction lengths fetched", "tenant", tenant, "tenants", len(result.Tenants))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// bucketTransactionLengths sorts the transaction counts, which must be
+// ordered by tenant, into each tenant's buckets. every tenant gets all
+// of the buckets, including the empty ones.
+func bucketTransactionLengths(counts []TransactionLengthCount) []TenantTransactionLengths {
+	tenants := []TenantTransactionLengths{}
+	for i := range counts {
+		if len(tenants) == 0 || tenants[len(tenants)-1].Tenant != counts[i].Tenant {
+			tenants = append(tenants, TenantTransactionLengths{Tenant: counts[i].Tenant, Buckets: emptyTransactionLengthBuckets()})
+		}
+
+		buckets := tenants[len(tenants)-1].Buckets
+		for j := range buckets {
+			if buckets[j].Max == 0 || counts[i].Length <= buckets[j].Max {
+				buckets[j].Count += counts[i].Count
+				break
+			}
+		}
+	}
+
+	return tenants
+}
+
+func emptyTransactionLengthBuckets() []TransactionLengthBucket {
+	buckets := make([]TransactionLengthBucket, 0, len(transactionLengthBucketBounds)+1)
+	min := int64(1)
+	for _, max := range transactionLengthBucketBounds {
+		buckets = append(buckets, TransactionLengthBucket{Min: min, Max: max})
+		min = max + 1
+	}
+
+	return append(buckets, TransactionLengthBucket{Min: min})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleGetTransactionNoMatchingOperations(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "operation type not played", query: "&operation_type=DEBIT"},
+		{name: "since the last sequence", query: "&since_sequence=1"},
+		{name: "both", query: "&operation_type=HOLD&since_sequence=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/get_transaction?tenant=%s&transaction_id=%d%s", testTenant, played.Transaction.TransactionID, tt.query)
+			w := testRequest(t, HandleGetTransactionWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var res struct {
+				Transaction Transaction      `json:"transaction"`
+				Operations  *json.RawMessage `json:"operations"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if res.Transaction.TransactionID != played.Transaction.TransactionID {
+				t.Errorf("expected transaction %d, got %d", played.Transaction.TransactionID, res.Transaction.TransactionID)
+			}
+			// an empty list rather than null
+			if res.Operations == nil || string(*res.Operations) != "[]" {
+				t.Errorf("expected operations to be [], got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleGetTransactionOperationsCap(t *testing.T) {
+	defer func(maxOperationsPerTransactionRead int) {
+		config.MaxOperationsPerTransactionRead = maxOperationsPerTransactionRead
+	}(config.MaxOperationsPerTransactionRead)
+	config.MaxOperationsPerTransactionRead = 3
+	pool := testPool(t)
+
+	tests := []struct {
+		name               string
+		played             int
+		expectedOperations int
+		expectedTruncated  bool
+	}{
+		{name: "under the cap", played: 2, expectedOperations: 2, expectedTruncated: false},
+		{name: "at the cap", played: 3, expectedOperations: 3, expectedTruncated: false},
+		{name: "exceeding the cap", played: 5, expectedOperations: 3, expectedTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testAccount(t, pool)
+			var operations []operationRequest
+			for i := 0; i < tt.played; i++ {
+				operations = append(operations, op("CREDIT", 100))
+			}
+			played := testPlay(t, pool, account.AccountID, operations...)
+
+			target := fmt.Sprintf("/get_transaction?tenant=%s&transaction_id=%d", testTenant, played.Transaction.TransactionID)
+			w := testRequest(t, HandleGetTransactionWithContext, pool, http.MethodGet, target, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var res TransactionWithOperations
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if len(res.Operations) != tt.expectedOperations {
+				t.Errorf("expected %d operations, got %d", tt.expectedOperations, len(res.Operations))
+			}
+			if res.Truncated != tt.expectedTruncated {
+				t.Errorf("expected truncated %t, got %t", tt.expectedTruncated, res.Truncated)
+			}
+			// the latest are the ones kept
+			for _, operation := range res.Operations {
+				if operation.Sequence <= int64(tt.played-tt.expectedOperations) {
+					t.Errorf("expected only the latest %d operations, got sequence %d", tt.expectedOperations, operation.Sequence)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,15 @@ go 1.16
 
 require (
 	github.com/fergusstrange/embedded-postgres v1.17.0
+	github.com/jackc/pgx/v4 v4.17.0
 	github.com/pressly/goose/v3 v3.7.0
+	github.com/prometheus/client_golang v1.12.2
+	go.opentelemetry.io/otel v1.11.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.11.0
+	go.opentelemetry.io/otel/sdk v1.11.0
+	go.opentelemetry.io/otel/trace v1.11.0
 	go.uber.org/zap v1.13.0
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/grpc v1.51.0 // indirect
 )
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// the migration version this build of the code was written against,
+// i.e. the latest migration shipped alongside it. it's pinned rather
+// than read from the migrations directory, which is the one goose.Up
+// applies at startup and so would always agree with the database.
+// TestExpectedMigrationVersion fails when a migration is added
+// without it being bumped.
+const expectedMigrationVersion int64 = 20261016220000
+
+// checkMigrationVersionSkew distinguishes a database that's behind
+// the code (migrations weren't applied) from one that's ahead of it
+// (the code was rolled back past a migration), both of which mean
+// queries may reference columns that aren't there.
+func checkMigrationVersionSkew(ctx context.Context, pool *sql.DB) error {
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	actualMigrationVersion, err := GetMigrationVersionWithContext(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("error getting database migration version: %w", err)
+	}
+
+	if actualMigrationVersion < expectedMigrationVersion {
+		return fmt.Errorf("error database behind code, code expects migration v%d, database is at v%d", expectedMigrationVersion, actualMigrationVersion)
+	}
+	if actualMigrationVersion > expectedMigrationVersion {
+		return fmt.Errorf("error code behind database, code expects migration v%d, database is at v%d", expectedMigrationVersion, actualMigrationVersion)
+	}
+
+	return nil
+}
+
+// HandleLiveness reports the process is up, it doesn't touch the
+// database so an unreachable one doesn't get healthy instances
+// restarted, and keeps answering while the server drains.
+func HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleReadinessWithContext reports whether the instance should be
+// sent traffic, i.e. it isn't draining and its database is reachable
+// and migrated to the version the code expects.
+func HandleReadinessWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if isDraining() {
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, errors.New("error server shutting down"))
+		return
+	}
+
+	if err := pool.PingContext(ctx); err != nil {
+		logger.Error(err)
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error pinging database: %w", err))
+		return
+	}
+
+	if err := checkMigrationVersionSkew(ctx, pool); err != nil {
+		logger.Error(err)
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+)
+
+func TestExpectedMigrationVersion(t *testing.T) {
+	migrations, err := goose.CollectMigrations(migrationsDirectory, 0, goose.MaxVersion)
+	if err != nil {
+		t.Fatalf("error collecting migrations: %s", err)
+	}
+	latest, err := migrations.Last()
+	if err != nil {
+		t.Fatalf("error getting latest migration: %s", err)
+	}
+
+	if latest.Version != expectedMigrationVersion {
+		t.Errorf("expected migration version v%d, the latest migration is v%d, bump expectedMigrationVersion", expectedMigrationVersion, latest.Version)
+	}
+}
+
+func TestCheckMigrationVersionSkew(t *testing.T) {
+	pool := testPool(t)
+
+	if err := checkMigrationVersionSkew(context.Background(), pool); err != nil {
+		t.Errorf("expected the migrated database to match the code, got %s", err)
+	}
+
+	version, err := goose.GetDBVersion(pool)
+	if err != nil {
+		t.Fatalf("error getting database version: %s", err)
+	}
+	tx, err := pool.BeginTx(context.Background(), readOnlyTxOptions)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer tx.Rollback()
+	if actual, err := GetMigrationVersionWithContext(context.Background(), tx); err != nil || actual != version {
+		t.Errorf("expected version v%d as goose reads it, got v%d, %v", version, actual, err)
+	}
+}
+
+func TestCheckMigrationVersionSkewCancelled(t *testing.T) {
+	pool := testPool(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := checkMigrationVersionSkew(ctx, pool); err == nil {
+		t.Errorf("expected checking with a cancelled context to fail")
+	}
+}
+
+func TestHandleReadinessWhileDraining(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	startDraining()
+
+	// rejected before the pool is used
+	w := testRequest(t, HandleReadinessWithContext, nil, http.MethodGet, "/readyz", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 once draining, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a Retry-After once draining")
+	}
+
+	// still alive until it has drained
+	live := httptest.NewRecorder()
+	HandleLiveness(live, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if live.Code != http.StatusOK {
+		t.Errorf("expected liveness 200 while draining, got %d", live.Code)
+	}
+}
+
+func TestHandleReadinessUntilDraining(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	pool := testPool(t)
+
+	if w := testRequest(t, HandleReadinessWithContext, pool, http.MethodGet, "/readyz", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 before draining, got %d: %s", w.Code, w.Body.String())
+	}
+	startDraining()
+	// the database is still reachable, it's the shutdown that counts
+	if w := testRequest(t, HandleReadinessWithContext, pool, http.MethodGet, "/readyz", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 once draining, got %d: %s", w.Code, w.Body.String())
+	}
+}
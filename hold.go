@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// holds are authorizations, and card networks
+// don't honour authorizations past a month.
+const maxHoldDuration = 31 * 24 * time.Hour
+
+type HoldRequest struct {
+	AccountID             uint64 `json:"account_id"`
+	Tenant                string `json:"tenant"`
+	TransactionID         uint64 `json:"transaction_id"`
+	AmountInCents         uint   `json:"amount_in_cents"`
+	HoldDurationInSeconds uint64 `json:"hold_duration_in_seconds"`
+	ClientIdentifier      string `json:"client_identifier"`
+	ClientUUID            string `json:"client_uuid"`
+}
+
+func (h HoldRequest) Validate() error {
+	if h.AccountID == 0 {
+		return errors.New("error missing account_id")
+	}
+	if h.Tenant == "" {
+		return errors.New("error missing tenant")
+	}
+	if h.AmountInCents == 0 {
+		return errors.New("error missing amount_in_cents")
+	}
+	// amounts are played as int64s
+	if uint64(h.AmountInCents) > math.MaxInt64 {
+		return errors.New("error invalid amount_in_cents")
+	}
+	if h.ClientIdentifier == "" {
+		return errors.New("error missing client_identifier")
+	}
+	if h.ClientUUID == "" {
+		return errors.New("error missing client_uuid")
+	}
+	if h.HoldDurationInSeconds == 0 {
+		return errors.New("error missing hold_duration_in_seconds")
+	}
+	if h.HoldDurationInSeconds > uint64(maxHoldDuration/time.Second) {
+		return fmt.Errorf("error hold duration exceeds %d days", maxHoldDuration/(24*time.Hour))
+	}
+
+	return nil
+}
+
+type HoldResponse struct {
+	Account     Account     `json:"account"`
+	Transaction Transaction `json:"transaction"`
+	Fees        []Operation `json:"fees,omitempty"`
+	// what's left to be held or debited once the hold is placed,
+	// running balances already have the held amounts taken out
+	AvailableBalanceInCents int64 `json:"available_balance_in_cents"`
+}
+
+type holdMetadata struct {
+	Hold struct {
+		ExpiresAt        time.Time `json:"expires_at"`
+		ClientIdentifier string    `json:"client_identifier"`
+		ClientUUID       string    `json:"client_uuid"`
+	} `json:"hold"`
+}
+
+// banker places holds on behalf of the hold handlers,
+// which only deal in HTTP and leave the accounting to it.
+type banker interface {
+	ExecuteHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error)
+	// AuthorizeHoldWithContext only places the hold if the available
+	// balance covers it, failing with ErrInsufficientFunds otherwise
+	AuthorizeHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error)
+}
+
+// poolBanker is the banker backed by the database, playing
+// holds as HOLD operations just as execute_operations would.
+type poolBanker struct {
+	pool *sql.DB
+}
+
+func NewPoolBanker(pool *sql.DB) banker {
+	return poolBanker{pool: pool}
+}
+
+func (b poolBanker) ExecuteHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error) {
+	return b.placeHoldWithContext(ctx, req, false)
+}
+
+func (b poolBanker) AuthorizeHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error) {
+	return b.placeHoldWithContext(ctx, req, true)
+}
+
+func (b poolBanker) placeHoldWithContext(ctx context.Context, req HoldRequest, authorize bool) (HoldResponse, error) {
+	var metadata holdMetadata
+	metadata.Hold.ExpiresAt = time.Now().Add(time.Duration(req.HoldDurationInSeconds) * time.Second)
+	metadata.Hold.ClientIdentifier = req.ClientIdentifier
+	metadata.Hold.ClientUUID = req.ClientUUID
+	marshaledMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return HoldResponse{}, fmt.Errorf("error marshaling metadata: %w", err)
+	}
+	operations, err := operationsWithFees(req.Tenant, []Operation{{OperationType: "HOLD", AmountInCents: int64(req.AmountInCents), Metadata: marshaledMetadata}})
+	if err != nil {
+		return HoldResponse{}, err
+	}
+
+	var result executeOperationsResponse
+	err = withRetryableTx(ctx, b.pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		account, err := LockAccountWithContext(ctx, tx, req.AccountID)
+		if err != nil {
+			return fmt.Errorf("error locking account: %w", err)
+		}
+
+		// checked under the account lock, so nothing
+		// can take the funds between checking and holding
+		if authorize {
+			var requiredInCents int64
+			for i := range operations {
+				var ok bool
+				if requiredInCents, ok = addInt64(requiredInCents, operations[i].AmountInCents); !ok {
+					return ErrAmountOverflow
+				}
+			}
+			if requiredInCents > account.RunningBalance {
+				result.Account = account
+				return ErrInsufficientFunds
+			}
+		}
+
+		if req.TransactionID != 0 {
+			transaction, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
+			if err != nil {
+				return fmt.Errorf("error getting transaction: %w", err)
+			}
+			result, err = processExistingTransaction(ctx, tx, operations, account, transaction)
+			if err != nil {
+				return fmt.Errorf("error processing hold: %w", err)
+			}
+		} else {
+			result, err = processNewTransaction(ctx, tx, req.Tenant, operations, account)
+			if err != nil {
+				return fmt.Errorf("error processing hold: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrInsufficientFunds) {
+		return HoldResponse{AvailableBalanceInCents: result.Account.RunningBalance}, err
+	}
+	if err != nil {
+		return HoldResponse{}, err
+	}
+
+	return HoldResponse{
+		Account:                 result.Account,
+		Transaction:             result.Transaction,
+		Fees:                    result.Fees,
+		AvailableBalanceInCents: result.Account.RunningBalance,
+	}, nil
+}
+
+func HoldWithContext(ctx context.Context, banker banker, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received hold request")
+	handleHoldWithContext(ctx, banker.ExecuteHoldWithContext, w, r)
+}
+
+// AuthorizeHoldWithContext checks the available balance and holds in
+// one step, rejecting with insufficient funds rather than placing a
+// hold the account can't cover.
+func AuthorizeHoldWithContext(ctx context.Context, banker banker, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received authorize hold request")
+	handleHoldWithContext(ctx, banker.AuthorizeHoldWithContext, w, r)
+}
+
+func handleHoldWithContext(ctx context.Context, placeHold func(context.Context, HoldRequest) (HoldResponse, error), w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var holdRequest HoldRequest
+	if err := decodeRequestBody(r.Body, &holdRequest); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if err := holdRequest.Validate(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !accountGate.TryAcquire(holdRequest.AccountID) {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, config.ConcurrencyRetryAfter, fmt.Errorf("error too many concurrent requests for account"))
+		return
+	}
+	defer accountGate.Release(holdRequest.AccountID)
+
+	logger.Infow("handling hold request", "request", redacted(holdRequest))
+	result, err := placeHold(ctx, holdRequest)
+	if errors.Is(err, ErrInsufficientFunds) {
+		marshaledData, err := json.Marshal(struct {
+			errorResponse
+			AvailableBalanceInCents int64 `json:"available_balance_in_cents"`
+		}{errorResponse{ErrInsufficientFunds.Error(), errorCode(config.BusinessRejectionStatus, ErrInsufficientFunds)}, result.AvailableBalanceInCents})
+		if err != nil {
+			logger.Errorf("error marshaling hold response: %s", err.Error())
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+			debug.PrintStack()
+			return
+		}
+		w.WriteHeader(config.BusinessRejectionStatus)
+		w.Write(marshaledData)
+		return
+	}
+	if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) {
+		writeHTTPError(w, config.BusinessRejectionStatus, ErrInvalidPlayOrderNegativeBalance)
+		return
+	}
+	// kept as is, a release exceeding a hold has its own code
+	if errors.Is(err, ErrInvalidPlayOrderNegativeHold) {
+		writeHTTPError(w, config.BusinessRejectionStatus, err)
+		return
+	}
+	if errors.Is(err, ErrAmountOverflow) {
+		writeHTTPError(w, config.BusinessRejectionStatus, ErrAmountOverflow)
+		return
+	}
+	if errors.Is(err, ErrTooManyActiveHolds) {
+		writeHTTPError(w, config.BusinessRejectionStatus, ErrTooManyActiveHolds)
+		return
+	}
+	if errors.Is(err, ErrTransactionOperationLimit) {
+		writeHTTPError(w, config.BusinessRejectionStatus, ErrTransactionOperationLimit)
+		return
+	}
+	if errors.Is(err, ErrTransactionAccountMismatch) {
+		writeHTTPError(w, http.StatusForbidden, ErrTransactionAccountMismatch)
+		return
+	}
+	if errors.Is(err, ErrTransactionClosed) {
+		writeHTTPError(w, http.StatusConflict, ErrTransactionClosed)
+		return
+	}
+	if errors.Is(err, ErrAccountClosed) {
+		writeHTTPError(w, http.StatusConflict, ErrAccountClosed)
+		return
+	}
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account/transaction not found"))
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(holdRequest), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing hold: %w", err))
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Errorf("timed out executing hold request: %s", err.Error())
+		writeHTTPError(w, http.StatusGatewayTimeout, fmt.Errorf("error executing hold: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing hold request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing hold: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling hold response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("hold placed", "request", redacted(holdRequest), "result", redacted(result))
+	observeOperationAmounts([]operationRequest{{OperationType: "HOLD", AmountInCents: int64(holdRequest.AmountInCents)}})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHoldRequestValidate(t *testing.T) {
+	valid := HoldRequest{
+		AccountID:             1,
+		Tenant:                "tenant",
+		AmountInCents:         100,
+		HoldDurationInSeconds: 60,
+		ClientIdentifier:      "client",
+		ClientUUID:            "8c5b6a5e-4c42-4d4c-9d0e-3f0c2f6e1a7b",
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*HoldRequest)
+		wantErr string
+	}{
+		{name: "valid", modify: func(h *HoldRequest) {}},
+		{name: "missing account_id", modify: func(h *HoldRequest) { h.AccountID = 0 }, wantErr: "error missing account_id"},
+		{name: "missing tenant", modify: func(h *HoldRequest) { h.Tenant = "" }, wantErr: "error missing tenant"},
+		{name: "missing amount_in_cents", modify: func(h *HoldRequest) { h.AmountInCents = 0 }, wantErr: "error missing amount_in_cents"},
+		{name: "missing client_identifier", modify: func(h *HoldRequest) { h.ClientIdentifier = "" }, wantErr: "error missing client_identifier"},
+		{name: "missing client_uuid", modify: func(h *HoldRequest) { h.ClientUUID = "" }, wantErr: "error missing client_uuid"},
+		{name: "missing hold_duration_in_seconds", modify: func(h *HoldRequest) { h.HoldDurationInSeconds = 0 }, wantErr: "error missing hold_duration_in_seconds"},
+		{name: "31 day hold", modify: func(h *HoldRequest) { h.HoldDurationInSeconds = uint64(maxHoldDuration / time.Second) }},
+		{name: "over 31 day hold", modify: func(h *HoldRequest) { h.HoldDurationInSeconds = uint64(maxHoldDuration/time.Second) + 1 }, wantErr: "error hold duration exceeds 31 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			err := req.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// rejectingBanker fails every hold with its error.
+type rejectingBanker struct {
+	err error
+}
+
+func (b rejectingBanker) ExecuteHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error) {
+	return HoldResponse{}, b.err
+}
+
+func (b rejectingBanker) AuthorizeHoldWithContext(ctx context.Context, req HoldRequest) (HoldResponse, error) {
+	return HoldResponse{}, b.err
+}
+
+func TestHoldRejections(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "negative balance", err: ErrInvalidPlayOrderNegativeBalance, expectedStatus: config.BusinessRejectionStatus, expectedCode: "NEGATIVE_BALANCE"},
+		{name: "negative hold", err: ErrInvalidPlayOrderNegativeHold, expectedStatus: config.BusinessRejectionStatus, expectedCode: "NEGATIVE_HOLD"},
+		{name: "release exceeding a hold", err: fmt.Errorf("error processing hold: %w", ErrReleaseExceedsHold), expectedStatus: config.BusinessRejectionStatus, expectedCode: "RELEASE_EXCEEDS_HOLD"},
+		{name: "amount overflow", err: ErrAmountOverflow, expectedStatus: config.BusinessRejectionStatus, expectedCode: "AMOUNT_OVERFLOW"},
+		{name: "too many active holds", err: ErrTooManyActiveHolds, expectedStatus: config.BusinessRejectionStatus, expectedCode: "TOO_MANY_ACTIVE_HOLDS"},
+		{name: "transaction operation limit", err: fmt.Errorf("error processing hold: %w", ErrTransactionOperationLimit), expectedStatus: config.BusinessRejectionStatus, expectedCode: "TRANSACTION_OPERATION_LIMIT"},
+		{name: "insufficient funds", err: ErrInsufficientFunds, expectedStatus: config.BusinessRejectionStatus, expectedCode: "INSUFFICIENT_FUNDS"},
+		{name: "another account's transaction", err: ErrTransactionAccountMismatch, expectedStatus: http.StatusForbidden, expectedCode: "TRANSACTION_ACCOUNT_MISMATCH"},
+		{name: "closed transaction", err: ErrTransactionClosed, expectedStatus: http.StatusConflict, expectedCode: "TRANSACTION_CLOSED"},
+		{name: "closed account", err: ErrAccountClosed, expectedStatus: http.StatusConflict, expectedCode: "ACCOUNT_CLOSED"},
+		{name: "not found", err: ErrNotFound, expectedStatus: http.StatusNotFound, expectedCode: "NOT_FOUND"},
+		{name: "other", err: errors.New("error unexpected"), expectedStatus: http.StatusInternalServerError, expectedCode: "INTERNAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(HoldRequest{
+				AccountID:             1,
+				Tenant:                testTenant,
+				AmountInCents:         100,
+				HoldDurationInSeconds: 60,
+				ClientIdentifier:      "client",
+				ClientUUID:            "8c5b6a5e-4c42-4d4c-9d0e-3f0c2f6e1a7b",
+			})
+			if err != nil {
+				t.Fatalf("error marshaling request: %s", err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/hold", bytes.NewReader(data))
+			w := httptest.NewRecorder()
+			HoldWithContext(context.Background(), rejectingBanker{err: tt.err}, w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			var res errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if res.Code != tt.expectedCode {
+				t.Errorf("expected code %s, got %s", tt.expectedCode, res.Code)
+			}
+		})
+	}
+}
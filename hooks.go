@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	hookPollInterval   = 1 * time.Second
+	hookDeliveryBatch  = 10
+	hookRequestTimeout = 5 * time.Second
+	// undelivered hooks are left in the outbox after this many attempts
+	hookMaxAttempts = 10
+	hookMaxBackoff  = 1 * time.Hour
+	// claimed hooks are delivered one after the other,
+	// the lease covers every one of them timing out
+	hookClaimLease = 2 * hookDeliveryBatch * hookRequestTimeout
+)
+
+var hookClient = &http.Client{Timeout: hookRequestTimeout}
+
+// operationHookPayload is what's POSTed to a tenant's hook
+// for an operation, along with the balance it resulted in.
+type operationHookPayload struct {
+	Operation      Operation `json:"operation"`
+	AccountID      uint64    `json:"account_id"`
+	RunningBalance int64     `json:"running_balance"`
+	RunningHeld    int64     `json:"running_held"`
+}
+
+// OperationHook is a webhook due in the outbox.
+type OperationHook struct {
+	OperationHookPK uint64
+	Tenant          string
+	URL             string
+	Payload         json.RawMessage
+	Attempts        int
+}
+
+// enqueueOperationHooks adds a hook to the outbox for each played
+// operation whose type the tenant has a hook for. it's written in the
+// transaction recording the operations, so hooks are only ever
+// delivered for operations that were committed.
+func enqueueOperationHooks(ctx context.Context, tx *sql.Tx, transaction Transaction, operations []Operation, events []Event) error {
+	hooks := config.TenantConfig(transaction.Tenant).Hooks
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	for i := range operations {
+		url, ok := hooks[operations[i].OperationType]
+		if !ok {
+			continue
+		}
+
+		operation := operations[i]
+		operation.Tenant = transaction.Tenant
+		operation.TransactionID = transaction.TransactionID
+		payload, err := json.Marshal(operationHookPayload{
+			Operation:      operation,
+			AccountID:      transaction.AccountID,
+			RunningBalance: events[i].RunningBalance,
+			RunningHeld:    events[i].RunningHeld,
+		})
+		if err != nil {
+			return fmt.Errorf("error marshaling hook payload: %w", err)
+		}
+		if err := EnqueueOperationHookWithContext(ctx, tx, transaction.Tenant, url, payload); err != nil {
+			return fmt.Errorf("error enqueueing hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RunOperationHookDeliveries delivers hooks from the outbox until
+// the context is cancelled. failed deliveries are attempted again
+// with exponential backoff, and never affect the operations.
+func RunOperationHookDeliveries(ctx context.Context, pool *sql.DB) {
+	ticker := time.NewTicker(hookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := deliverOperationHooks(ctx, pool); err != nil {
+			logger.Errorf("error delivering operation hooks: %s", err.Error())
+		}
+	}
+}
+
+// deliverOperationHooks delivers a batch of due hooks. the hooks are
+// claimed in a transaction of their own, so servers sharing the database
+// don't deliver the same hook twice at once, then delivered outside of
+// any, and their outcomes recorded in another. no transaction is held
+// open across the deliveries, which are at least once: a server going
+// away mid batch leaves its hooks to be delivered again after the lease.
+func deliverOperationHooks(ctx context.Context, pool *sql.DB) error {
+	var hooks []OperationHook
+	err := runTx(ctx, pool, nil, func(tx *sql.Tx) error {
+		var err error
+		hooks, err = ClaimDueOperationHooksWithContext(ctx, tx, hookMaxAttempts, hookDeliveryBatch, hookClaimLease)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error claiming due hooks: %w", err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	failures := make([]error, len(hooks))
+	for i := range hooks {
+		failures[i] = deliverOperationHook(ctx, hooks[i])
+	}
+
+	err = runTx(ctx, pool, nil, func(tx *sql.Tx) error {
+		for i := range hooks {
+			if failures[i] == nil {
+				if err := MarkOperationHookDeliveredWithContext(ctx, tx, hooks[i]); err != nil {
+					return fmt.Errorf("error marking hook delivered: %w", err)
+				}
+				continue
+			}
+
+			backoff := hookBackoff(hooks[i].Attempts)
+			logger.Warnw("error delivering operation hook", "tenant", hooks[i].Tenant, "operation_hook_pk", hooks[i].OperationHookPK, "attempts", hooks[i].Attempts, "retry_in", backoff, "error", failures[i].Error())
+			if err := RetryOperationHookWithContext(ctx, tx, hooks[i], backoff); err != nil {
+				return fmt.Errorf("error rescheduling hook: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error recording hook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func deliverOperationHook(ctx context.Context, hook OperationHook) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(hook.Payload))
+	if err != nil {
+		return fmt.Errorf("error building request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := hookClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("error unexpected status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// hookBackoff doubles from the poll interval with each attempt, up to the max.
+func hookBackoff(attempts int) time.Duration {
+	backoff := hookPollInterval
+	for i := 1; i < attempts && backoff < hookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > hookMaxBackoff {
+		return hookMaxBackoff
+	}
+
+	return backoff
+}
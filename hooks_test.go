@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: hookPollInterval},
+		{attempts: 2, expected: 2 * hookPollInterval},
+		{attempts: 4, expected: 8 * hookPollInterval},
+		{attempts: 100, expected: hookMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if backoff := hookBackoff(tt.attempts); backoff != tt.expected {
+			t.Errorf("attempt %d: expected backoff %s, got %s", tt.attempts, tt.expected, backoff)
+		}
+	}
+}
+
+// testEnqueueHook adds a hook to the outbox, returning its pk.
+func testEnqueueHook(t *testing.T, pool *sql.DB, url string) uint64 {
+	t.Helper()
+	var operationHookPK uint64
+	row := pool.QueryRowContext(context.Background(), `
+		INSERT INTO operation_hooks(tenant, url, payload)
+		VALUES($1, $2, '{}'::JSONB)
+		RETURNING operation_hook_pk
+	`, testTenant, url)
+	if err := row.Scan(&operationHookPK); err != nil {
+		t.Fatalf("error enqueueing hook: %s", err)
+	}
+	t.Cleanup(func() {
+		pool.ExecContext(context.Background(), "DELETE FROM operation_hooks WHERE operation_hook_pk = $1", operationHookPK)
+	})
+
+	return operationHookPK
+}
+
+func TestDeliverOperationHooksOutsideTransaction(t *testing.T) {
+	pool := testPool(t)
+
+	var lockErr error
+	var claimedAgain []OperationHook
+	var operationHookPK uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// while it's being delivered, the hook is neither
+		// locked nor claimable by anyone else
+		lockErr = runTx(r.Context(), pool, nil, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(r.Context(), "SELECT 1 FROM operation_hooks WHERE operation_hook_pk = $1 FOR UPDATE NOWAIT", operationHookPK)
+			if err != nil {
+				return err
+			}
+			claimedAgain, err = ClaimDueOperationHooksWithContext(r.Context(), tx, hookMaxAttempts, hookDeliveryBatch, hookClaimLease)
+			return err
+		})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	operationHookPK = testEnqueueHook(t, pool, server.URL)
+
+	if err := deliverOperationHooks(context.Background(), pool); err != nil {
+		t.Fatalf("error delivering hooks: %s", err)
+	}
+	if lockErr != nil {
+		t.Errorf("expected the hook not to be locked while delivered, got %s", lockErr)
+	}
+	for i := range claimedAgain {
+		if claimedAgain[i].OperationHookPK == operationHookPK {
+			t.Errorf("expected the hook not to be claimed again while delivered")
+		}
+	}
+
+	var delivered sql.NullTime
+	var attempts int
+	row := pool.QueryRowContext(context.Background(), "SELECT delivered, attempts FROM operation_hooks WHERE operation_hook_pk = $1", operationHookPK)
+	if err := row.Scan(&delivered, &attempts); err != nil {
+		t.Fatalf("error reading hook: %s", err)
+	}
+	if !delivered.Valid || attempts != 1 {
+		t.Errorf("expected the hook to be delivered on its first attempt, got delivered %v after %d attempts", delivered.Valid, attempts)
+	}
+}
+
+func TestDeliverOperationHooksReschedulesFailures(t *testing.T) {
+	pool := testPool(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	operationHookPK := testEnqueueHook(t, pool, server.URL)
+
+	if err := deliverOperationHooks(context.Background(), pool); err != nil {
+		t.Fatalf("error delivering hooks: %s", err)
+	}
+
+	var delivered sql.NullTime
+	var attempts int
+	var retryInSeconds float64
+	row := pool.QueryRowContext(context.Background(), "SELECT delivered, attempts, EXTRACT(EPOCH FROM next_attempt - NOW()) FROM operation_hooks WHERE operation_hook_pk = $1", operationHookPK)
+	if err := row.Scan(&delivered, &attempts, &retryInSeconds); err != nil {
+		t.Fatalf("error reading hook: %s", err)
+	}
+	retryIn := time.Duration(retryInSeconds * float64(time.Second))
+	if delivered.Valid || attempts != 1 {
+		t.Errorf("expected the hook to be undelivered after 1 attempt, got delivered %v after %d attempts", delivered.Valid, attempts)
+	}
+	// backed off rather than left on its lease
+	if retryIn <= 0 || retryIn > hookBackoff(1) {
+		t.Errorf("expected the hook to be retried within %s, got %s", hookBackoff(1), retryIn)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// how many expired keys each transaction deletes, keeping
+// the locks they take short while clearing a backlog
+const idempotencyKeyCleanupBatch = 1000
+
+// RunIdempotencyKeyCleanup deletes expired idempotency keys every
+// cleanup interval until the context is cancelled, keeping the table
+// bounded. the keys stop replaying once they expire either way.
+func RunIdempotencyKeyCleanup(ctx context.Context, pool *sql.DB) {
+	ticker := time.NewTicker(config.IdempotencyKeyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := deleteExpiredIdempotencyKeys(ctx, pool)
+		if err != nil {
+			logger.Errorf("error cleaning up idempotency keys: %s", err.Error())
+		}
+		if deleted > 0 {
+			logger.Infow("expired idempotency keys deleted", "deleted", deleted)
+		}
+	}
+}
+
+// deleteExpiredIdempotencyKeys deletes expired keys a batch at
+// a time, until there are none left or the context is cancelled.
+func deleteExpiredIdempotencyKeys(ctx context.Context, pool *sql.DB) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		var deleted int64
+		err := runTx(ctx, pool, nil, func(tx *sql.Tx) error {
+			var err error
+			deleted, err = DeleteExpiredIdempotencyKeysWithContext(ctx, tx, idempotencyKeyCleanupBatch)
+			return err
+		})
+		if err != nil {
+			return total, fmt.Errorf("error deleting expired keys: %w", err)
+		}
+		total += deleted
+		if deleted < idempotencyKeyCleanupBatch {
+			break
+		}
+	}
+
+	return total, nil
+}
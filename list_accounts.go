@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+const (
+	defaultListAccountsLimit = 100
+	maxListAccountsLimit     = 500
+)
+
+type listAccountsResponse struct {
+	Accounts []Account `json:"accounts"`
+	// empty when there are no more accounts
+	NextCursor string `json:"next_cursor"`
+}
+
+// HandleListAccountsWithContext pages through every account, oldest
+// first, optionally only those whose user_ari starts with a prefix.
+// the cursor is keyed on account_pk, which is never reused, so
+// accounts created while paging are on the last pages.
+func HandleListAccountsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received list accounts request")
+	var err error
+	limit := defaultListAccountsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxListAccountsLimit {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid limit parameter, must be between 1 and %d", maxListAccountsLimit))
+			return
+		}
+	}
+	cursor, err := decodePKCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid cursor parameter"))
+		return
+	}
+	userARIPrefix := r.URL.Query().Get("user_ari_prefix")
+
+	logger.Infow("handling list accounts request", "limit", limit, "cursor", cursor, "user_ari_prefix", redacted(map[string]string{"user_ari": userARIPrefix}))
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning list accounts transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	// one past the limit to know if there are more
+	accounts, err := ListAccountsWithContext(ctx, tx, limit+1, cursor, userARIPrefix)
+	if err != nil {
+		logger.Errorf("error executing list accounts database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing list accounts transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := listAccountsResponse{Accounts: accounts}
+	if len(accounts) > limit {
+		result.Accounts = accounts[:limit]
+		result.NextCursor = encodePKCursor(accounts[limit-1].AccountPK)
+	}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling list accounts response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("accounts listed", "limit", limit, "cursor", cursor, "count", len(result.Accounts), "next_cursor", result.NextCursor)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
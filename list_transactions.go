@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+const (
+	defaultListTransactionsLimit = 100
+	maxListTransactionsLimit     = 500
+)
+
+type listTransactionsResponse struct {
+	Transactions []Transaction `json:"transactions"`
+	// empty when there are no more transactions
+	NextCursor string `json:"next_cursor"`
+}
+
+func HandleListTransactionsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received list transactions request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
+		return
+	}
+	limit := defaultListTransactionsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxListTransactionsLimit {
+			writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid limit parameter, must be between 1 and %d", maxListTransactionsLimit))
+			return
+		}
+	}
+	cursor, err := decodePKCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid cursor parameter"))
+		return
+	}
+
+	logger.Infow("handling list transactions request", "account_id", accountID, "tenant", tenant, "limit", limit, "cursor", cursor)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning list transactions transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	// one past the limit to know if there are more
+	transactions, err := ListTransactionsWithContext(ctx, tx, accountID, tenant, limit+1, cursor)
+	if err != nil {
+		logger.Errorf("error executing list transactions database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing list transactions transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := listTransactionsResponse{Transactions: transactions}
+	if len(transactions) > limit {
+		result.Transactions = transactions[:limit]
+		result.NextCursor = encodePKCursor(transactions[limit-1].TransactionPK)
+	}
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling list transactions response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("transactions listed", "account_id", accountID, "tenant", tenant, "count", len(result.Transactions), "next_cursor", result.NextCursor)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// cursors are opaque to clients, so what
+// they're keyed on is free to change.
+func encodePKCursor(pk uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(pk, 10)))
+}
+
+// decodePKCursor returns the primary key, e.g. the transaction_pk,
+// the cursor continues after, zero for an empty cursor, i.e. the
+// first page.
+func decodePKCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding cursor: %w", err)
+	}
+	pk, err := strconv.ParseUint(string(decoded), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing cursor: %w", err)
+	}
+
+	return pk, nil
+}
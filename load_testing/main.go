@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -57,12 +58,13 @@ type executeOperationsResponse struct {
 
 const (
 	accountContention = 0.3
+	accountCount      = 100
 )
 
 var (
 	r             *rand.Rand                     = rand.New(rand.NewSource(time.Now().UnixNano()))
 	accounts      map[uint64]map[string][]uint64 = make(map[uint64]map[string][]uint64)
-	accountIDs    []uint64                       = make([]uint64, 100)
+	accountIDs    []uint64                       = []uint64{}
 	numbers                                      = []uint{100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000}
 	forwardOps                                   = []string{"RELEASE", "CREDIT"}
 	backwardOps                                  = []string{"HOLD", "DEBIT"}
@@ -77,6 +79,10 @@ var (
 func getRandomAccount() uint64 {
 	accountContentionBias := 1 - accountContention
 	biasedAccountSwath := int(float64(len(accountIDs)) * accountContentionBias)
+	// fewer accounts may have been set up than asked for
+	if biasedAccountSwath < 1 {
+		biasedAccountSwath = 1
+	}
 	return accountIDs[r.Intn(biasedAccountSwath)]
 }
 
@@ -87,9 +93,19 @@ func getRandomTransaction(accountID uint64, tenant string) uint64 {
 }
 
 func main() {
+	maxWorkers := flag.Uint("max-workers", 0, "caps the workers across all tenants, scaling their fanouts down proportionally, 0 for no cap")
+	setupConcurrency := flag.Uint("setup-concurrency", 10, "accounts set up concurrently before the load test starts")
+	flag.Parse()
+
 	log.SetFlags(0)
 	log.Println("init load tests")
 
+	cappedTenantConfigs, err := CapFanouts(tenantConfigs, *maxWorkers)
+	if err != nil {
+		log.Fatalf("error capping workers: %s", err.Error())
+	}
+	tenantConfigs = cappedTenantConfigs
+
 	errChan := make(chan struct{}, 10000000)
 	httpReadAccountErrorChan := make(chan struct{}, 10000000)
 	httpReadTransactionErrorChan := make(chan struct{}, 10000000)
@@ -131,32 +147,43 @@ func main() {
 	log.Println("setup metric collection")
 
 	log.Println("setting up accounts and transactions")
-	for i := 0; i < len(accountIDs); i++ {
-		log.Printf("processing account %d", i)
-		account, statusCode, err := CreateAccount(uuid.New().String())
-		if err != nil {
-			log.Fatalf("error setting up accounts: %s", err.Error())
-		}
-		if statusCode != 200 {
-			log.Fatalf("error setting up accounts, http statuscode: %d", statusCode)
-		}
-		accountIDs[i] = account.AccountID
-		accounts[account.AccountID] = make(map[string][]uint64)
-		for j := range tenantConfigs {
-			accounts[account.AccountID][tenantConfigs[j].Tenant] = make([]uint64, 10)
-			for k := 0; k < len(accounts[account.AccountID][tenantConfigs[j].Tenant]); k++ {
-				result, statusCode, err := CreateTransaction(account.AccountID, tenantConfigs[j].Tenant)
+	if *setupConcurrency < 1 {
+		log.Fatalf("error setup concurrency must be at least 1")
+	}
+	// accounts that fail to be set up are left out of the
+	// load test, which only needs some accounts to go on
+	var setupMutex sync.Mutex
+	var setupWG sync.WaitGroup
+	var setupFailures uint
+	setupQueue := make(chan int)
+	for i := 0; i < int(*setupConcurrency); i++ {
+		setupWG.Add(1)
+		go func() {
+			defer setupWG.Done()
+			for i := range setupQueue {
+				log.Printf("processing account %d", i)
+				accountID, transactions, err := SetupAccount()
+				setupMutex.Lock()
 				if err != nil {
-					log.Fatalf("error setting up transactions: %s", err.Error())
-				}
-				if statusCode != 200 {
-					log.Fatalf("error setting up transactions, http statuscode: %d", statusCode)
+					log.Printf("error setting up account %d: %s", i, err.Error())
+					setupFailures++
+				} else {
+					accountIDs = append(accountIDs, accountID)
+					accounts[accountID] = transactions
 				}
-				accounts[account.AccountID][tenantConfigs[j].Tenant][k] = result.Transaction.TransactionID
+				setupMutex.Unlock()
 			}
-		}
+		}()
+	}
+	for i := 0; i < accountCount; i++ {
+		setupQueue <- i
 	}
-	log.Println("set up accounts and transactions")
+	close(setupQueue)
+	setupWG.Wait()
+	if len(accountIDs) == 0 {
+		log.Fatalf("error setting up accounts, all %d failed", setupFailures)
+	}
+	log.Printf("set up %d accounts and transactions, %d failed", len(accountIDs), setupFailures)
 
 	log.Println("starting load test")
 	var wg sync.WaitGroup
@@ -173,6 +200,35 @@ func main() {
 	fmt.Println("load tests done")
 }
 
+// SetupAccount creates an account along with transactions
+// for every tenant, returning the transactions by tenant.
+func SetupAccount() (uint64, map[string][]uint64, error) {
+	account, statusCode, err := CreateAccount(uuid.New().String())
+	if err != nil {
+		return 0, nil, fmt.Errorf("error creating account: %w", err)
+	}
+	if statusCode != 200 {
+		return 0, nil, fmt.Errorf("error creating account, http statuscode: %d", statusCode)
+	}
+
+	transactions := make(map[string][]uint64)
+	for j := range tenantConfigs {
+		transactions[tenantConfigs[j].Tenant] = make([]uint64, 10)
+		for k := 0; k < len(transactions[tenantConfigs[j].Tenant]); k++ {
+			result, statusCode, err := CreateTransaction(account.AccountID, tenantConfigs[j].Tenant)
+			if err != nil {
+				return 0, nil, fmt.Errorf("error creating transaction: %w", err)
+			}
+			if statusCode != 200 {
+				return 0, nil, fmt.Errorf("error creating transaction, http statuscode: %d", statusCode)
+			}
+			transactions[tenantConfigs[j].Tenant][k] = result.Transaction.TransactionID
+		}
+	}
+
+	return account.AccountID, transactions, nil
+}
+
 func CreateAccount(userARI string) (Account, int, error) {
 	request := createAccountRequest{UserARI: userARI}
 	requestBody, _ := json.Marshal(request)
@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 )
@@ -263,6 +265,54 @@ func (t TenantTester) Work() {
 	}
 }
 
+// CapFanouts scales the fanouts of the tenant configs down so that
+// they add up to at most maxWorkers, keeping them proportional to the
+// configured fanouts, with every tenant keeping at least one worker.
+// a zero maxWorkers leaves the fanouts as configured.
+func CapFanouts(tenantConfigs []TenantConfig, maxWorkers uint) ([]TenantConfig, error) {
+	if maxWorkers == 0 {
+		return tenantConfigs, nil
+	}
+	if maxWorkers < uint(len(tenantConfigs)) {
+		return nil, fmt.Errorf("error max workers %d is less than the %d tenants", maxWorkers, len(tenantConfigs))
+	}
+
+	var totalFanout uint
+	for i := range tenantConfigs {
+		totalFanout += tenantConfigs[i].Fanout
+	}
+	if totalFanout <= maxWorkers {
+		return tenantConfigs, nil
+	}
+
+	// every tenant is guaranteed a worker, the rest are shared
+	// out proportionally, largest remainders first
+	capped := make([]TenantConfig, len(tenantConfigs))
+	copy(capped, tenantConfigs)
+	shared := maxWorkers - uint(len(capped))
+	remainders := make([]float64, len(capped))
+	assigned := uint(len(capped))
+	for i := range capped {
+		share := float64(shared) * float64(capped[i].Fanout) / float64(totalFanout)
+		capped[i].Fanout = 1 + uint(share)
+		remainders[i] = share - float64(uint(share))
+		assigned += uint(share)
+	}
+	order := make([]int, len(capped))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for i := 0; assigned < maxWorkers; i++ {
+		capped[order[i%len(order)]].Fanout++
+		assigned++
+	}
+
+	return capped, nil
+}
+
 func (t TenantTester) Spawn() {
 	var wg sync.WaitGroup
 	for i := 0; i < int(t.Fanout); i++ {
@@ -2,31 +2,73 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 var logger *zap.SugaredLogger
 
+// set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 const (
 	httpServerAddressEnvVar = "HTTP_ADDRESS"
-	shutdownGracePeriod     = 5 * time.Second
+	// an embedded postgres is started when unset, see
+	// Config.PostgresBinariesPath for starting it offline
+	databaseURLEnvVar = "DATABASE_URL"
+
+	// the request timeouts have to fit inside it, see timeoutsConfig
+	httpWriteTimeout = 10000 * time.Millisecond
 )
 
 func main() {
 	logger = zap.NewExample().Sugar()
+	defer syncLogger()
 	logger.Info("lesgo")
 
-	dbServer, pool := MustSetupDB()
-	// pool := MustSetupRealDB()
+	config = MustLoadConfig()
+	accountGate = NewAccountGate(config.MaxConcurrentRequestsPerAccount)
+	responseCache = NewResponseCache(config.ResponseCacheSize)
+	createAccountLimiter = NewRateLimiter(config.CreateAccountRatePerMinute)
+	createAccountIPLimiter = NewRateLimiter(config.CreateAccountRatePerMinutePerIP)
+
+	var dbServer *embeddedpostgres.EmbeddedPostgres
+	var pool *sql.DB
+	if os.Getenv(databaseURLEnvVar) != "" {
+		pool = MustSetupRealDB()
+	} else {
+		dbServer, pool = MustSetupDB()
+	}
 
 	logger.Info("database setup")
 
+	if config.PoolWarmupConnections > 0 {
+		warmupCtx, warmupCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := WarmupPoolWithContext(warmupCtx, pool, config.PoolWarmupConnections); err != nil {
+			logger.Fatal(err)
+		}
+		warmupCancel()
+		logger.Infow("connection pool warmed up", "connections", config.PoolWarmupConnections)
+	}
+
+	MustRegisterMetrics()
+
+	tracerProvider := MustSetupTracing(config.TracingEndpoint)
+
 	httpServerAddress := MustLoadEnvVar(httpServerAddressEnvVar)
 
 	mainCtx, mainCancel := context.WithCancel(context.Background())
@@ -34,8 +76,8 @@ func main() {
 	signalCtx, signalCancel := signal.NotifyContext(mainCtx, os.Interrupt)
 	defer signalCancel()
 
-	http.HandleFunc("/health-check", func(w http.ResponseWriter, r *http.Request) {
-		pingContext, pingCancel := context.WithTimeout(mainCtx, 100*time.Millisecond)
+	http.HandleFunc("/health-check", instrumentHandler("/health-check", func(w http.ResponseWriter, r *http.Request) {
+		pingContext, pingCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.HealthCheck)
 		defer pingCancel()
 		if err := pool.PingContext(pingContext); err != nil {
 			logger.Error(err)
@@ -43,42 +85,282 @@ func main() {
 
 			return
 		}
-	})
-	http.HandleFunc("/create_account", func(w http.ResponseWriter, r *http.Request) {
-		createContext, creationCancel := context.WithTimeout(mainCtx, 100*time.Millisecond)
+	}))
+	http.HandleFunc("/readyz", instrumentHandler("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readyContext, readyCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.HealthCheck)
+		defer readyCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleReadinessWithContext(readyContext, pool, w, r)
+	}))
+	// not instrumented, which would turn it away with a 503 while
+	// draining, the process is still alive until it has drained
+	http.HandleFunc("/livez", HandleLiveness)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/capabilities", instrumentHandler("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		HandleCapabilities(w, r)
+	}))
+	http.HandleFunc("/create_account", instrumentHandler("/create_account", func(w http.ResponseWriter, r *http.Request) {
+		createContext, creationCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.CreateAccount)
 		defer creationCancel()
 
 		w.Header().Set("Content-Type", "application/json")
 		HandleCreateAccountWithContext(createContext, pool, w, r)
-	})
-	http.HandleFunc("/execute_operations", func(w http.ResponseWriter, r *http.Request) {
-		executeContext, executionCancel := context.WithTimeout(mainCtx, 2000*time.Millisecond)
+	}))
+	http.HandleFunc("/batch_create_accounts", instrumentHandler("/batch_create_accounts", func(w http.ResponseWriter, r *http.Request) {
+		createContext, creationCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer creationCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleBatchCreateAccountsWithContext(createContext, pool, w, r)
+	}))
+	http.HandleFunc("/close_account", instrumentHandler("/close_account", func(w http.ResponseWriter, r *http.Request) {
+		closeContext, closeCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer closeCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleCloseAccountWithContext(closeContext, pool, w, r)
+	}))
+	http.HandleFunc("/execute_operations", instrumentHandler("/execute_operations", func(w http.ResponseWriter, r *http.Request) {
+		// tightened to the tenant's timeout once the request is read
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.MaxTenantTimeout)
 		defer executionCancel()
 
 		w.Header().Set("Content-Type", "application/json")
 		HandleExecuteOperationsWithContext(executeContext, pool, w, r)
-	})
-	http.HandleFunc("/get_account", func(w http.ResponseWriter, r *http.Request) {
-		getContext, getCancel := context.WithTimeout(mainCtx, 500*time.Millisecond)
+	}))
+	http.HandleFunc("/batch_execute_operations", instrumentHandler("/batch_execute_operations", func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleBatchExecuteOperationsWithContext(executeContext, pool, w, r)
+	}))
+	http.HandleFunc("/simulate_operations", instrumentHandler("/simulate_operations", func(w http.ResponseWriter, r *http.Request) {
+		simulateContext, simulateCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer simulateCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleSimulateOperationsWithContext(simulateContext, pool, w, r)
+	}))
+	holdBanker := NewPoolBanker(pool)
+	http.HandleFunc("/hold", instrumentHandler("/hold", func(w http.ResponseWriter, r *http.Request) {
+		holdContext, holdCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer holdCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HoldWithContext(holdContext, holdBanker, w, r)
+	}))
+	http.HandleFunc("/authorize_hold", instrumentHandler("/authorize_hold", func(w http.ResponseWriter, r *http.Request) {
+		holdContext, holdCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer holdCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		AuthorizeHoldWithContext(holdContext, holdBanker, w, r)
+	}))
+	http.HandleFunc("/reverse_transaction", instrumentHandler("/reverse_transaction", func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleReverseTransactionWithContext(executeContext, pool, w, r)
+	}))
+	http.HandleFunc("/release_transaction_holds", instrumentHandler("/release_transaction_holds", func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleReleaseTransactionHoldsWithContext(executeContext, pool, w, r)
+	}))
+	http.HandleFunc("/transfer_hold", instrumentHandler("/transfer_hold", func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleTransferHoldWithContext(executeContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account", instrumentHandler("/get_account", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
 		defer getCancel()
 
 		w.Header().Set("Content-Type", "application/json")
 		HandleGetAccountWithContext(getContext, pool, w, r)
-	})
-	http.HandleFunc("/get_transaction", func(w http.ResponseWriter, r *http.Request) {
-		getContext, getCancel := context.WithTimeout(mainCtx, 500*time.Millisecond)
+	}))
+	http.HandleFunc("/get_operation", instrumentHandler("/get_operation", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetOperationWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_by_ari", instrumentHandler("/get_account_by_ari", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountByARIWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_transaction", instrumentHandler("/get_transaction", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
 		defer getCancel()
 
 		w.Header().Set("Content-Type", "application/json")
 		HandleGetTransactionWithContext(getContext, pool, w, r)
-	})
+	}))
+	http.HandleFunc("/list_transactions", instrumentHandler("/list_transactions", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleListTransactionsWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_largest_transaction", instrumentHandler("/get_largest_transaction", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetLargestTransactionWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_activity", instrumentHandler("/get_account_activity", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountActivityWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_operation_rate", instrumentHandler("/get_account_operation_rate", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountOperationRateWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_operation_chain", instrumentHandler("/get_operation_chain", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetOperationChainWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_transaction_lengths", instrumentHandler("/get_transaction_lengths", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetTransactionLengthsWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_held_operations", instrumentHandler("/get_held_operations", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetHeldOperationsWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_balance", instrumentHandler("/get_account_balance", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountBalanceWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_transaction_balance_at_sequence", instrumentHandler("/get_transaction_balance_at_sequence", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetTransactionBalanceAtSequenceWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_events", instrumentHandler("/get_events", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetEventsWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_positions", instrumentHandler("/get_account_positions", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountPositionsWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/get_account_snapshot", instrumentHandler("/get_account_snapshot", func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleGetAccountSnapshotWithContext(getContext, pool, w, r)
+	}))
+	http.HandleFunc("/export_account", instrumentHandler("/export_account", func(w http.ResponseWriter, r *http.Request) {
+		exportContext, exportCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Stream)
+		defer exportCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleExportAccountWithContext(exportContext, pool, w, r)
+	}))
+	http.HandleFunc("/transaction_history", instrumentHandler("/transaction_history", func(w http.ResponseWriter, r *http.Request) {
+		historyContext, historyCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Stream)
+		defer historyCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleTransactionHistoryWithContext(historyContext, pool, w, r)
+	}))
+	http.HandleFunc("/export_operations_csv", instrumentHandler("/export_operations_csv", func(w http.ResponseWriter, r *http.Request) {
+		exportContext, exportCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Stream)
+		defer exportCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleExportOperationsCSVWithContext(exportContext, pool, w, r)
+	}))
+	http.HandleFunc("/admin/set_balance", instrumentHandler("/admin/set_balance", adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleSetBalanceWithContext(executeContext, pool, w, r)
+	})))
+	http.HandleFunc("/admin/set_overdraft_limit", instrumentHandler("/admin/set_overdraft_limit", adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		executeContext, executionCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.ExecuteOperations)
+		defer executionCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleSetOverdraftLimitWithContext(executeContext, pool, w, r)
+	})))
+	http.HandleFunc("/admin/check_orphaned_operations", instrumentHandler("/admin/check_orphaned_operations", adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		checkContext, checkCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.IntegrityCheck)
+		defer checkCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleCheckOrphanedOperationsWithContext(checkContext, pool, w, r)
+	})))
+	http.HandleFunc("/admin/list_accounts", instrumentHandler("/admin/list_accounts", adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		getContext, getCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.Get)
+		defer getCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleListAccountsWithContext(getContext, pool, w, r)
+	})))
+	http.HandleFunc("/admin/reconcile_account", instrumentHandler("/admin/reconcile_account", adminOnly(func(w http.ResponseWriter, r *http.Request) {
+		checkContext, checkCancel := context.WithTimeout(tracedContext(mainCtx, r), config.Timeouts.IntegrityCheck)
+		defer checkCancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		HandleReconcileAccountWithContext(checkContext, pool, w, r)
+	})))
+
+	go RunOperationHookDeliveries(mainCtx, pool)
+	if config.IdempotencyKeyTTL > 0 {
+		go RunIdempotencyKeyCleanup(mainCtx, pool)
+	}
 
 	server := &http.Server{
 		ReadTimeout:  5000 * time.Millisecond,
-		WriteTimeout: 10000 * time.Millisecond,
+		WriteTimeout: httpWriteTimeout,
 		IdleTimeout:  1000 * time.Millisecond,
 		Addr:         httpServerAddress,
 		Handler:      http.DefaultServeMux,
+		ConnContext:  withConn,
 	}
 	go func() {
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
@@ -89,25 +371,45 @@ func main() {
 	// shutdown signal received
 	<-signalCtx.Done()
 
-	// a second before the rug is yanked from under
-	// cancel the main context, causing all executing
-	// routines, that should respect context to gracefully
-	// error out of execution.
+	// start shutdown sequence - no more new requests being served,
+	// the ones in flight are waited on for the grace period
+	startDraining()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), config.ShutdownGracePeriod)
+	defer shutdownCancel()
+
+	// only if they're still running when just the reserve is left
+	// is the main context cancelled, as a last resort, causing all
+	// executing routines, that should respect context to gracefully
+	// error out of execution before the rug is yanked from under.
+	drained := make(chan struct{})
 	go func() {
-		time.Sleep(shutdownGracePeriod - 1*time.Second)
-		mainCancel()
+		select {
+		case <-drained:
+		case <-time.After(config.ShutdownGracePeriod - config.ShutdownCancelReserve):
+			logger.Warn("requests still in flight, cancelling them")
+			mainCancel()
+		}
 	}()
 
-	// start shutdown sequence - no more new requests being served
-	shutdownCtx, shutdownCancel := context.WithTimeout(mainCtx, shutdownGracePeriod)
-	defer shutdownCancel()
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("error shutting down server: %w", err)
 	}
+	close(drained)
+	// stops what runs in the background, e.g. hook deliveries
+	mainCancel()
+
+	// flush the spans still batched up
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("error shutting down tracing: %s", err.Error())
+		}
+	}
 
 	pool.Close()
-	if err := dbServer.Stop(); err != nil {
-		logger.Fatal(err)
+	if dbServer != nil {
+		if err := dbServer.Stop(); err != nil {
+			logger.Fatal(err)
+		}
 	}
 }
 
@@ -123,15 +425,136 @@ func MustLoadEnvVar(envVar string) string {
 	return value
 }
 
+// syncLogger flushes any buffered log entries before exit.
+// stdout and stderr don't support fsync on most platforms,
+// so zap reports an EINVAL/ENOTTY syncing them which is harmless.
+func syncLogger() {
+	if err := logger.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		fmt.Fprintf(os.Stderr, "error syncing logger: %s\n", err.Error())
+	}
+}
+
 func writeHTTPError(w http.ResponseWriter, statusCode int, err error) {
+	if statusCode == http.StatusInternalServerError {
+		statusCode = contextErrorStatus(err, statusCode)
+	}
 	w.WriteHeader(statusCode)
 
-	errorResponse := struct {
-		Errors string `json:"error"`
-	}{
-		err.Error(),
+	b, _ := json.Marshal(errorResponse{Error: err.Error(), Code: errorCode(statusCode, err)})
+	w.Write(b)
+}
+
+// cancelWhenClientGone returns a ctx that's also cancelled once the
+// client has gone away. handlers' contexts are derived from the
+// server's, the request's is only done once the client is gone, so
+// streaming handlers use it to stop reading what nobody will receive.
+func cancelWhenClientGone(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// nginx's non-standard status for a client
+// that went away before it was responded to
+const statusClientClosedRequest = 499
+
+// contextErrorStatus is the status to write an error with that
+// failed a request because its context ended. the server didn't
+// fail, the request ran out of time or the client gave up on it.
+// any other error keeps the given status.
+func contextErrorStatus(err error, statusCode int) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return statusClientClosedRequest
 	}
 
-	b, _ := json.Marshal(errorResponse)
-	w.Write(b)
+	return statusCode
+}
+
+// writeRetryableHTTPError writes the error along with a Retry-After
+// telling clients how long to back off before trying again.
+func writeRetryableHTTPError(w http.ResponseWriter, statusCode int, retryAfter time.Duration, err error) {
+	setRetryAfter(w, retryAfter)
+	writeHTTPError(w, statusCode, err)
+}
+
+// setRetryAfter sets the Retry-After header, which is in whole
+// seconds, rounding up so clients never retry any earlier.
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// earlyResponse fails a transaction, so it's rolled back,
+// with the response to write in place of committing it.
+type earlyResponse struct {
+	statusCode int
+	body       []byte
+	// sent as the Retry-After when set
+	retryAfter time.Duration
+	// what ended the transaction, if it was an error
+	cause error
+}
+
+func writeEarlyResponse(w http.ResponseWriter, early earlyResponse) {
+	if early.retryAfter > 0 {
+		setRetryAfter(w, early.retryAfter)
+	}
+
+	w.WriteHeader(early.statusCode)
+	w.Write(early.body)
+}
+
+func (e earlyResponse) Error() string {
+	return fmt.Sprintf("error ended early with status %d", e.statusCode)
+}
+
+func (e earlyResponse) Unwrap() error {
+	return e.cause
+}
+
+// earlyHTTPError is the early response for an error,
+// written just as writeHTTPError would write it.
+func earlyHTTPError(statusCode int, err error) earlyResponse {
+	b, _ := json.Marshal(errorResponse{Error: err.Error(), Code: errorCode(statusCode, err)})
+	return earlyResponse{statusCode: statusCode, body: b, cause: err}
+}
+
+type connContextKey struct{}
+
+// withConn is the server's ConnContext, keeping the connection
+// a request came in on in its context for extendWriteDeadline.
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// extendWriteDeadline gives the response another httpWriteTimeout to be
+// written in. the server's write timeout is a deadline on the response
+// as a whole, streaming handlers extend it before each record instead,
+// so they're only cut off by a client that stops reading, or by their
+// context, rather than by how long the stream is.
+func extendWriteDeadline(r *http.Request) {
+	if conn, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Now().Add(httpWriteTimeout))
+	}
+}
+
+// streamEndRecord is the last record of an NDJSON stream that was
+// sent in full, a stream ending without it was cut short, even if
+// the response seemingly completed.
+type streamEndRecord struct {
+	Complete bool `json:"complete"`
 }
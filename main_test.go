@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+)
+
+// the tenant the database tests play their operations in
+const testTenant = "test"
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop().Sugar()
+	config = MustLoadConfig()
+	accountGate = NewAccountGate(config.MaxConcurrentRequestsPerAccount)
+	responseCache = NewResponseCache(config.ResponseCacheSize)
+	createAccountLimiter = NewRateLimiter(config.CreateAccountRatePerMinute)
+	createAccountIPLimiter = NewRateLimiter(config.CreateAccountRatePerMinutePerIP)
+
+	os.Exit(m.Run())
+}
+
+var (
+	testPoolOnce sync.Once
+	testPoolDB   *sql.DB
+	testPoolErr  error
+)
+
+// testPool is a pool on the migrated database at DATABASE_URL,
+// the tests needing a database are skipped when it isn't set.
+func testPool(t testing.TB) *sql.DB {
+	t.Helper()
+	if os.Getenv(databaseURLEnvVar) == "" {
+		t.Skipf("%s not set, skipping database test", databaseURLEnvVar)
+	}
+
+	testPoolOnce.Do(func() {
+		testPoolDB, testPoolErr = open(os.Getenv(databaseURLEnvVar), config.Pool)
+		if testPoolErr == nil {
+			testPoolErr = goose.Up(testPoolDB, migrationsDirectory)
+		}
+	})
+	if testPoolErr != nil {
+		t.Fatalf("error setting up test database: %s", testPoolErr)
+	}
+
+	return testPoolDB
+}
+
+// testAccount creates an account for the test, with a user_ari
+// no other test, or run of the test, has created one for.
+func testAccount(t testing.TB, pool *sql.DB) Account {
+	t.Helper()
+	tx, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	account, err := CreateAccountWithContext(context.Background(), tx, fmt.Sprintf("ari:test:%s:%d", t.Name(), time.Now().UnixNano()))
+	if err != nil {
+		t.Fatalf("error creating account: %s", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("error committing account: %s", err)
+	}
+
+	return account
+}
+
+// testRequest calls the handler with the request, the body marshaled
+// to JSON unless it's already a string, returning the response.
+func testRequest(t testing.TB, handler func(context.Context, *sql.DB, http.ResponseWriter, *http.Request), pool *sql.DB, method string, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var marshaledBody []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		marshaledBody = []byte(b)
+	default:
+		var err error
+		marshaledBody, err = json.Marshal(b)
+		if err != nil {
+			t.Fatalf("error marshaling request body: %s", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler(context.Background(), pool, w, httptest.NewRequest(method, target, bytes.NewReader(marshaledBody)))
+
+	return w
+}
+
+// testPlay executes the operations on the account in a new transaction,
+// failing the test unless they're played, returning the response.
+func testPlay(t testing.TB, pool *sql.DB, accountID uint64, operations ...operationRequest) executeOperationsResponse {
+	t.Helper()
+	return testPlayOnTransaction(t, pool, accountID, 0, operations...)
+}
+
+// testPlayOnTransaction is testPlay on an existing transaction.
+func testPlayOnTransaction(t testing.TB, pool *sql.DB, accountID uint64, transactionID uint64, operations ...operationRequest) executeOperationsResponse {
+	t.Helper()
+	w := testRequest(t, HandleExecuteOperationsWithContext, pool, http.MethodPost, "/execute_operations", executeOperationsRequest{
+		AccountID:     accountID,
+		Tenant:        testTenant,
+		TransactionID: transactionID,
+		Operations:    operations,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected operations to be played, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var res executeOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+
+	return res
+}
+
+func op(typ string, amountInCents int64) operationRequest {
+	return operationRequest{OperationType: operationType(typ), AmountInCents: amountInCents}
+}
+
+// testGetAccount reads the account as it's committed.
+func testGetAccount(t testing.TB, pool *sql.DB, accountID uint64) Account {
+	t.Helper()
+	tx, err := pool.BeginTx(context.Background(), readOnlyTxOptions)
+	if err != nil {
+		t.Fatalf("error beginning transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	account, err := GetAccountWithContext(context.Background(), tx, accountID)
+	if err != nil {
+		t.Fatalf("error getting account: %s", err)
+	}
+
+	return account
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	const records = 6
+	tests := []struct {
+		name           string
+		extend         bool
+		expectComplete bool
+	}{
+		{name: "extended", extend: true, expectComplete: true},
+		{name: "cut off by the write timeout", extend: false, expectComplete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < records; i++ {
+					if tt.extend {
+						extendWriteDeadline(r)
+					}
+					fmt.Fprintf(w, "record %d\n", i)
+					w.(http.Flusher).Flush()
+					// the stream as a whole outlasts the write timeout
+					time.Sleep(25 * time.Millisecond)
+				}
+			}))
+			server.Config.WriteTimeout = 50 * time.Millisecond
+			server.Config.ConnContext = withConn
+			server.Start()
+			defer server.Close()
+
+			res, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatalf("error requesting stream: %s", err)
+			}
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+
+			complete := err == nil && bytes.Count(body, []byte("\n")) == records
+			if complete != tt.expectComplete {
+				t.Errorf("expected complete %t, got %t: %d bytes, %v", tt.expectComplete, complete, len(body), err)
+			}
+		})
+	}
+}
+
+func TestExtendWriteDeadlineWithoutConn(t *testing.T) {
+	// requests that didn't come in through the server are left alone
+	extendWriteDeadline(httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		expected   string
+	}{
+		{retryAfter: 0, expected: "1"},
+		{retryAfter: 200 * time.Millisecond, expected: "1"},
+		{retryAfter: time.Second, expected: "1"},
+		// rounded up, never telling clients to retry any earlier
+		{retryAfter: 1200 * time.Millisecond, expected: "2"},
+		{retryAfter: 5 * time.Second, expected: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.retryAfter.String(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			setRetryAfter(w, tt.retryAfter)
+			if got := w.Header().Get("Retry-After"); got != tt.expected {
+				t.Errorf("expected Retry-After %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryAfterOnRejections(t *testing.T) {
+	defer func(ipLimiter *RateLimiter, gate *AccountGate) {
+		createAccountIPLimiter = ipLimiter
+		accountGate = gate
+		atomic.StoreInt32(&draining, 0)
+	}(createAccountIPLimiter, accountGate)
+
+	tests := []struct {
+		name       string
+		setup      func()
+		handler    func(context.Context, *sql.DB, http.ResponseWriter, *http.Request)
+		target     string
+		body       interface{}
+		statusCode int
+		// the bounds, in seconds, of a sensible Retry-After
+		min, max int
+	}{
+		{
+			name: "rate limited",
+			setup: func() {
+				// two a minute, both used up, so the next is 30s away
+				createAccountIPLimiter = NewRateLimiter(2)
+				createAccountIPLimiter.AllowN("192.0.2.1", 2)
+			},
+			handler:    HandleCreateAccountWithContext,
+			target:     "/create_account",
+			body:       createAccountRequest{UserARI: "ari:test"},
+			statusCode: http.StatusTooManyRequests,
+			min:        29,
+			max:        30,
+		},
+		{
+			name: "too many concurrent requests",
+			setup: func() {
+				accountGate = NewAccountGate(1)
+				accountGate.TryAcquire(1)
+			},
+			handler:    HandleExecuteOperationsWithContext,
+			target:     "/execute_operations",
+			body:       executeOperationsRequest{AccountID: 1, Tenant: testTenant, Operations: []operationRequest{op("CREDIT", 100)}},
+			statusCode: http.StatusTooManyRequests,
+			min:        int(config.ConcurrencyRetryAfter.Seconds()),
+			max:        int(config.ConcurrencyRetryAfter.Seconds()),
+		},
+		{
+			name:  "draining",
+			setup: startDraining,
+			handler: func(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+				rejectWhileDraining(func(w http.ResponseWriter, r *http.Request) {
+					HandleCapabilities(w, r)
+				})(w, r)
+			},
+			target:     "/capabilities",
+			statusCode: http.StatusServiceUnavailable,
+			min:        int(config.UnavailableRetryAfter.Seconds()),
+			max:        int(config.UnavailableRetryAfter.Seconds()),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			// rejected before the pool is used
+			w := testRequest(t, tt.handler, nil, http.MethodPost, tt.target, tt.body)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+
+			retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil {
+				t.Fatalf("expected Retry-After in seconds, got %q", w.Header().Get("Retry-After"))
+			}
+			if retryAfter < tt.min || retryAfter > tt.max {
+				t.Errorf("expected Retry-After between %d and %d, got %d", tt.min, tt.max, retryAfter)
+			}
+		})
+	}
+}
+
+func TestWriteHTTPErrorContextErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		expected   int
+	}{
+		{name: "timed out", statusCode: http.StatusInternalServerError, err: fmt.Errorf("error executing query: %w", context.DeadlineExceeded), expected: http.StatusGatewayTimeout},
+		{name: "client gone", statusCode: http.StatusInternalServerError, err: fmt.Errorf("error executing query: %w", context.Canceled), expected: statusClientClosedRequest},
+		{name: "other server error", statusCode: http.StatusInternalServerError, err: errors.New("error executing query"), expected: http.StatusInternalServerError},
+		// only errors that would be a 500 are remapped
+		{name: "client error", statusCode: http.StatusBadRequest, err: fmt.Errorf("error decoding: %w", context.DeadlineExceeded), expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeHTTPError(w, tt.statusCode, tt.err)
+			if w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlersEndedContext(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+
+	handlers := []struct {
+		name    string
+		handler func(context.Context, *sql.DB, http.ResponseWriter, *http.Request)
+		method  string
+		target  string
+		body    interface{}
+	}{
+		{name: "get account", handler: HandleGetAccountWithContext, method: http.MethodGet, target: fmt.Sprintf("/get_account?account_id=%d", account.AccountID)},
+		{name: "get transaction", handler: HandleGetTransactionWithContext, method: http.MethodGet, target: fmt.Sprintf("/get_transaction?tenant=%s&transaction_id=%d", testTenant, played.Transaction.TransactionID)},
+		{name: "execute operations", handler: HandleExecuteOperationsWithContext, method: http.MethodPost, target: "/execute_operations", body: executeOperationsRequest{AccountID: account.AccountID, Tenant: testTenant, Operations: []operationRequest{op("CREDIT", 100)}}},
+	}
+	contexts := []struct {
+		name     string
+		ended    func() context.Context
+		expected int
+	}{
+		{name: "cancelled", ended: func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}, expected: statusClientClosedRequest},
+		{name: "timed out", ended: func() context.Context {
+			// already past, cancelling it after doesn't change why it ended
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			cancel()
+			return ctx
+		}, expected: http.StatusGatewayTimeout},
+	}
+
+	for _, h := range handlers {
+		for _, c := range contexts {
+			t.Run(h.name+" "+c.name, func(t *testing.T) {
+				// ended by the time the handler reaches the database
+				ctx := c.ended()
+				w := testRequest(t, func(_ context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+					h.handler(ctx, pool, w, r)
+				}, pool, h.method, h.target, h.body)
+
+				if w.Code != c.expected {
+					t.Errorf("expected status %d, got %d: %s", c.expected, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+	// nothing was played
+	if got := testGetAccount(t, pool, account.AccountID); got.RunningBalance != 100 {
+		t.Errorf("expected balance 100, got %d", got.RunningBalance)
+	}
+}
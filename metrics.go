@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buckets are in cents, spanning a dollar
+// through to a hundred thousand dollars which
+// comfortably covers what tenants move today.
+var operationAmountBuckets = []float64{
+	100,
+	500,
+	1000,
+	5000,
+	10000,
+	50000,
+	100000,
+	500000,
+	1000000,
+	10000000,
+}
+
+// not labeled by tenant, which is whatever the request says
+// it is and would give every new value its own set of series.
+var operationAmountHistogram = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "affount",
+		Name:      "operation_amount_in_cents",
+		Help:      "Distribution of committed operation amounts in cents.",
+		Buckets:   operationAmountBuckets,
+	},
+	[]string{"operation_type"},
+)
+
+var responseCacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "affount",
+		Name:      "response_cache_requests_total",
+		Help:      "Lookups of cached immutable read responses by endpoint and result (hit or miss).",
+	},
+	[]string{"endpoint", "result"},
+)
+
+var httpRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "affount",
+		Name:      "http_requests_total",
+		Help:      "Requests served by endpoint and status class (2xx, 4xx or 5xx).",
+	},
+	[]string{"endpoint", "status_class"},
+)
+
+var executeOperationsDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "affount",
+		Name:      "execute_operations_duration_seconds",
+		Help:      "Latency of execute_operations requests by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	},
+	[]string{"outcome"},
+)
+
+var executeOperationsOutcomes = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "affount",
+		Name:      "execute_operations_outcomes_total",
+		Help:      "execute_operations requests by outcome, telling business rejections such as negative_balance apart from errors.",
+	},
+	[]string{"outcome"},
+)
+
+// MustRegisterMetrics registers all the collectors
+// served on the metrics endpoint, and will panic
+// if any of them have already been registered.
+func MustRegisterMetrics() {
+	prometheus.MustRegister(
+		operationAmountHistogram,
+		responseCacheRequests,
+		httpRequests,
+		executeOperationsDuration,
+		executeOperationsOutcomes,
+	)
+}
+
+func observeOperationAmounts(operations []operationRequest) {
+	for i := range operations {
+		operationAmountHistogram.WithLabelValues(string(operations[i].OperationType)).Observe(float64(operations[i].AmountInCents))
+	}
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush passes flushes through, for handlers streaming their response.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrumentHandler counts the requests served by next
+// under the endpoint, by the class of their status code,
+// and traces each of them, see traceHandler. requests
+// are rejected once draining, see rejectWhileDraining.
+func instrumentHandler(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		traceHandler(endpoint, recorder, r, rejectWhileDraining(limitRequestBody(next)))
+		httpRequests.WithLabelValues(endpoint, strconv.Itoa(recorder.statusCode/100)+"xx").Inc()
+	}
+}
+
+// the outcomes of execute_operations requests that never
+// got as far as being played, see executeOperationsOutcome
+const (
+	executeOperationsOutcomeInvalid           = "invalid"
+	executeOperationsOutcomeTooManyConcurrent = "too_many_concurrent"
+)
+
+// executeOperationsOutcome classifies the result of
+// playing an execute_operations request's operations.
+func executeOperationsOutcome(err error) string {
+	var early earlyResponse
+	switch {
+	case err == nil:
+		return "executed"
+	case errors.Is(err, ErrInvalidPlayOrderNegativeBalance):
+		return "negative_balance"
+	case errors.Is(err, ErrInvalidPlayOrderNegativeHold):
+		return "negative_hold"
+	case errors.Is(err, ErrAmountOverflow):
+		return "amount_overflow"
+	case errors.Is(err, ErrTransactionAccountMismatch):
+		return "account_mismatch"
+	case errors.Is(err, ErrTransactionClosed):
+		return "transaction_closed"
+	case errors.Is(err, ErrAccountClosed):
+		return "account_closed"
+	case errors.Is(err, ErrTooManyActiveHolds):
+		return "too_many_active_holds"
+	case errors.Is(err, ErrTransactionOperationLimit):
+		return "transaction_operation_limit"
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		return "idempotency_key_reused"
+	case errors.Is(err, ErrConcurrentModification):
+		return "concurrent_modification"
+	case errors.Is(err, ErrAccountingInconsistency):
+		return "accounting_inconsistency"
+	case errors.Is(err, ErrEventSequenceGap), errors.Is(err, ErrDuplicateSequence):
+		return "sequence_conflict"
+	case isRetryableTxError(err):
+		return "serialization_failure"
+	case errors.Is(err, errDryRun):
+		return "dry_run"
+	case errors.As(err, &early) && early.statusCode == http.StatusOK:
+		return "replayed"
+	default:
+		return "error"
+	}
+}
+
+func observeExecuteOperations(outcome string, duration time.Duration) {
+	executeOperationsOutcomes.WithLabelValues(outcome).Inc()
+	executeOperationsDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
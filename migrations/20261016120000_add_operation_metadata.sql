@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- context for operations the server generates
+-- itself, e.g. the target of an admin balance set.
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+ALTER TABLE operations DROP COLUMN IF EXISTS metadata;
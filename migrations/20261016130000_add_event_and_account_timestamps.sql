@@ -0,0 +1,35 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS created TIMESTAMPTZ DEFAULT NOW();
+-- added without the default, so accounts the backfill can't
+-- date, those without any events, are left with created unknown
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS created TIMESTAMPTZ;
+
+-- existing rows would otherwise all claim to have
+-- been created at the time of the migration.
+UPDATE events
+SET created = operations.created
+FROM operations
+WHERE events.operation_id = operations.operation_id
+AND events.tenant = operations.tenant;
+
+UPDATE accounts
+SET created = first_events.created
+FROM (
+  SELECT account_id, MIN(created) AS created
+  FROM events
+  GROUP BY account_id
+) first_events
+WHERE accounts.account_id = first_events.account_id;
+
+ALTER TABLE accounts ALTER COLUMN created SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS events_account_id_created_idx ON events(account_id, created);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS events_account_id_created_idx;
+ALTER TABLE accounts DROP COLUMN IF EXISTS created;
+ALTER TABLE events DROP COLUMN IF EXISTS created;
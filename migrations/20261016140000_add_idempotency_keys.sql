@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- a key is reserved, with a null response, by the first
+-- request bearing it and completed in the same transaction
+-- as its operations, so only successful requests are kept.
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+  idempotency_key_pk BIGSERIAL PRIMARY KEY,
+  tenant TEXT,
+  idempotency_key TEXT,
+  request_hash TEXT,
+  transaction_id BIGINT,
+  response JSONB,
+  created TIMESTAMPTZ DEFAULT NOW(),
+  UNIQUE(tenant, idempotency_key)
+);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP TABLE IF EXISTS idempotency_keys;
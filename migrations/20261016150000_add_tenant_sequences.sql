@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- the last sequence handed out to each tenant numbering
+-- its operations across transactions, rows are created
+-- on the first reservation.
+CREATE TABLE IF NOT EXISTS tenant_sequences(
+  tenant TEXT PRIMARY KEY,
+  last_sequence BIGINT NOT NULL DEFAULT 0
+);
+
+-- null for tenants numbering operations per transaction only.
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS tenant_sequence BIGINT;
+CREATE UNIQUE INDEX IF NOT EXISTS operations_tenant_sequence_idx ON operations(tenant, tenant_sequence);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS operations_tenant_sequence_idx;
+ALTER TABLE operations DROP COLUMN IF EXISTS tenant_sequence;
+DROP TABLE IF EXISTS tenant_sequences;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- 'open' or 'closed', accounts are only ever
+-- closed once nothing is left in them.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'open';
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS status;
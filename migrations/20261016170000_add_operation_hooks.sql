@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- an outbox of the webhooks due for played operations, written
+-- in the same transaction as the operations and delivered once
+-- it commits, see deliverOperationHooks.
+CREATE TABLE IF NOT EXISTS operation_hooks(
+  operation_hook_pk BIGSERIAL PRIMARY KEY,
+  tenant TEXT,
+  url TEXT,
+  payload JSONB,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered TIMESTAMPTZ,
+  created TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS operation_hooks_pending_idx ON operation_hooks(next_attempt) WHERE delivered IS NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS operation_hooks_pending_idx;
+DROP TABLE IF EXISTS operation_hooks;
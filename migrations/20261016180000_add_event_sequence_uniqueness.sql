@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- an account's log can't have two events at the same
+-- sequence, a play reusing one fails instead of forking it.
+CREATE UNIQUE INDEX IF NOT EXISTS events_account_id_sequence_idx ON events(account_id, sequence);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS events_account_id_sequence_idx;
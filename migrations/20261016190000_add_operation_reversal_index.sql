@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- reversals reference the operation they reverse from their
+-- metadata, see reversingOperations, looked up to follow chains.
+CREATE INDEX IF NOT EXISTS operations_reversal_of_idx
+ON operations(tenant, ((metadata->'reversal_of'->>'operation_id')::BIGINT))
+WHERE metadata->'reversal_of' IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS operations_reversal_of_idx;
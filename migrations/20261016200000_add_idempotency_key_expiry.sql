@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- keys reserved without a ttl never expire, as all of them
+-- did before, the index only covers the ones cleaned up.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS expires TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys(expires) WHERE expires IS NOT NULL;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+DROP INDEX IF EXISTS idempotency_keys_expires_idx;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS expires;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- how far below zero the account's balance may be played,
+-- accounts default to none, as all of them were before.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS overdraft_limit_in_cents BIGINT NOT NULL DEFAULT 0 CHECK (overdraft_limit_in_cents >= 0);
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS overdraft_limit_in_cents;
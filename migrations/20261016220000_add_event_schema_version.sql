@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in this section is executed when the migration is applied.
+
+-- the version of the event schema the event was recorded with,
+-- every event recorded before it was versioned is version 1.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS schema_version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+-- SQL in this section is executed when the migration is rolled back.
+
+ALTER TABLE events DROP COLUMN IF EXISTS schema_version;
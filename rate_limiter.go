@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter admits up to a number of requests per minute for
+// each key, refilling continuously as a token bucket, so bursts
+// of up to the full minute's worth are let through at once.
+type RateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	buckets   map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// buckets kept before the full ones are dropped, a full
+// bucket is no different from one that was never seen
+const maxRateBuckets = 10000
+
+var createAccountLimiter *RateLimiter
+var createAccountIPLimiter *RateLimiter
+
+// NewRateLimiter returns a limiter admitting perMinute requests
+// per key, a limit of zero or less admits everything.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{
+		perMinute: perMinute,
+		buckets:   make(map[string]*rateBucket),
+	}
+}
+
+// Allow takes a request from the key's bucket, returning false
+// along with how long until one is available if it's empty.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN takes n requests from the key's bucket at once, for a
+// request doing the work of several, returning false along with
+// how long until there are n if there aren't, taking none of them.
+// n is at most the limit, a larger n can never be allowed.
+func (l *RateLimiter) AllowN(key string, n int) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.dropFullBuckets(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(l.perMinute), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(l.perMinute), bucket.tokens+now.Sub(bucket.updated).Minutes()*float64(l.perMinute))
+	bucket.updated = now
+
+	if bucket.tokens < float64(n) {
+		return false, time.Duration((float64(n) - bucket.tokens) / float64(l.perMinute) * float64(time.Minute))
+	}
+	bucket.tokens -= float64(n)
+
+	return true, 0
+}
+
+// Limit is the number of requests admitted per minute
+// for each key, zero or less when everything is admitted.
+func (l *RateLimiter) Limit() int {
+	return l.perMinute
+}
+
+// dropFullBuckets drops the buckets that have filled back
+// up once there are too many, so the map doesn't grow
+// with every key ever seen.
+func (l *RateLimiter) dropFullBuckets(now time.Time) {
+	if len(l.buckets) < maxRateBuckets {
+		return
+	}
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Minutes()*float64(l.perMinute) >= float64(l.perMinute) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// sourceIP is the address the request came from. proxies'
+// forwarding headers are ignored, clients can set them freely.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
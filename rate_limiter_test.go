@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		requests  int
+		allowed   int
+	}{
+		{name: "unlimited", perMinute: 0, requests: 100, allowed: 100},
+		{name: "under the limit", perMinute: 10, requests: 5, allowed: 5},
+		{name: "at the limit", perMinute: 10, requests: 10, allowed: 10},
+		{name: "over the limit", perMinute: 10, requests: 15, allowed: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.perMinute)
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				if ok, _ := limiter.Allow("key"); ok {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("expected %d allowed, got %d", tt.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowRetryAfter(t *testing.T) {
+	limiter := NewRateLimiter(60)
+	for i := 0; i < 60; i++ {
+		limiter.Allow("key")
+	}
+
+	allowed, retryAfter := limiter.Allow("key")
+	if allowed {
+		t.Fatal("expected the request over the limit to be rejected")
+	}
+	// a token refills every second at 60 a minute
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("expected a retry after of at most a second, got %s", retryAfter)
+	}
+}
+
+func TestRateLimiterAllowKeysSeparately(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Fatal("expected the first request for a to be allowed")
+	}
+	if ok, _ := limiter.Allow("a"); ok {
+		t.Fatal("expected the second request for a to be rejected")
+	}
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Fatal("expected b not to be limited by a's requests")
+	}
+}
+
+func TestRateLimiterAllowRefills(t *testing.T) {
+	limiter := NewRateLimiter(2)
+	limiter.Allow("key")
+	limiter.Allow("key")
+	if ok, _ := limiter.Allow("key"); ok {
+		t.Fatal("expected the bucket to be empty")
+	}
+
+	// as if half a minute had passed
+	limiter.buckets["key"].updated = limiter.buckets["key"].updated.Add(-30 * time.Second)
+	if ok, _ := limiter.Allow("key"); !ok {
+		t.Fatal("expected a token to have refilled")
+	}
+	if ok, _ := limiter.Allow("key"); ok {
+		t.Fatal("expected only one token to have refilled")
+	}
+}
+
+func TestRateLimiterAllowN(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		taken     int
+		n         int
+		allowed   bool
+	}{
+		{name: "unlimited", perMinute: 0, n: 1000, allowed: true},
+		{name: "whole bucket", perMinute: 10, n: 10, allowed: true},
+		{name: "more than is left", perMinute: 10, taken: 5, n: 6, allowed: false},
+		{name: "exactly what is left", perMinute: 10, taken: 5, n: 5, allowed: true},
+		{name: "more than the limit", perMinute: 10, n: 11, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.perMinute)
+			if tt.taken > 0 {
+				limiter.AllowN("key", tt.taken)
+			}
+			if allowed, _ := limiter.AllowN("key", tt.n); allowed != tt.allowed {
+				t.Errorf("expected allowed %t, got %t", tt.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowNTakesNothingWhenRejected(t *testing.T) {
+	limiter := NewRateLimiter(10)
+	if ok, _ := limiter.AllowN("key", 11); ok {
+		t.Fatal("expected more than the limit to be rejected")
+	}
+	if ok, _ := limiter.AllowN("key", 10); !ok {
+		t.Fatal("expected the rejected request not to have taken any tokens")
+	}
+}
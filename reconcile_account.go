@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// a value the account row disagrees with
+// what was recomputed from its history on
+type reconciliationDifference struct {
+	Field    string `json:"field"`
+	Source   string `json:"source"`
+	Recorded int64  `json:"recorded"`
+	Computed int64  `json:"computed"`
+}
+
+type reconcileAccountResponse struct {
+	AccountID  uint64 `json:"account_id"`
+	Consistent bool   `json:"consistent"`
+	// the account row as recorded
+	Account Account `json:"account"`
+	// what its operations add up to
+	Operations AccountOperationTotals `json:"operations"`
+	// the most recent event, absent when nothing has been played
+	LatestEvent *Event                     `json:"latest_event,omitempty"`
+	Differences []reconciliationDifference `json:"differences"`
+}
+
+// HandleReconcileAccountWithContext recomputes an account's running
+// balance, held amount and sequence from its operations, and checks
+// them along with its latest event against the account row. Play only
+// catches an inconsistency when the account's held amount goes negative,
+// this catches any, reporting every field that disagrees.
+func HandleReconcileAccountWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received reconcile account request")
+	accountID, err := strconv.ParseUint(r.URL.Query().Get("account_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid account_id parameter"))
+		return
+	}
+
+	logger.Infow("handling reconcile account request", "account_id", accountID)
+	// a single snapshot, so plays committing meanwhile
+	// can't make the reads disagree with each other
+	tx, err := pool.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		logger.Errorf("error beginning reconcile account transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := GetAccountWithContext(ctx, tx, accountID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing reconcile account database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	totals, err := SumAccountOperationsWithContext(ctx, tx, accountID)
+	if err != nil {
+		logger.Errorf("error executing reconcile account database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	var latestEvent *Event
+	event, err := GetLatestAccountEventWithContext(ctx, tx, accountID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		logger.Errorf("error executing reconcile account database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	if err == nil {
+		latestEvent = &event
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing reconcile account transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	result := reconcileAccountResponse{
+		AccountID:   accountID,
+		Account:     account,
+		Operations:  totals,
+		LatestEvent: latestEvent,
+		Differences: reconcileAccount(account, totals, latestEvent),
+	}
+	result.Consistent = len(result.Differences) == 0
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling reconcile account response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	if result.Consistent {
+		logger.Infow("account reconciled", "account_id", accountID)
+	} else {
+		logger.Errorw("account inconsistent with its history", "account_id", accountID, "differences", result.Differences)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// reconcileAccount lists what the account row disagrees on with its
+// operations and latest event. an account nothing was played on has
+// no event, and must still be at zero.
+func reconcileAccount(account Account, totals AccountOperationTotals, latestEvent *Event) []reconciliationDifference {
+	differences := []reconciliationDifference{}
+	compare := func(field string, source string, recorded int64, computed int64) {
+		if recorded != computed {
+			differences = append(differences, reconciliationDifference{Field: field, Source: source, Recorded: recorded, Computed: computed})
+		}
+	}
+
+	compare("running_balance", "operations", account.RunningBalance, totals.RunningBalance)
+	compare("running_held", "operations", account.RunningHeld, totals.RunningHeld)
+	compare("last_played_sequence", "operations", account.LastPlayedSequence, totals.Operations)
+
+	var event Event
+	if latestEvent != nil {
+		event = *latestEvent
+	}
+	compare("running_balance", "latest_event", account.RunningBalance, event.RunningBalance)
+	compare("running_held", "latest_event", account.RunningHeld, event.RunningHeld)
+	compare("last_played_sequence", "latest_event", account.LastPlayedSequence, event.Sequence)
+
+	return differences
+}
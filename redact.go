@@ -0,0 +1,51 @@
+package main
+
+import "encoding/json"
+
+const redactedValue = "[REDACTED]"
+
+// redacted returns a copy of the value, as it would be marshaled
+// to JSON, with the fields named in config.RedactedLogFields masked
+// at any depth, metadata included. it's meant for logging only.
+func redacted(value interface{}) interface{} {
+	marshaledData, err := json.Marshal(value)
+	if err != nil {
+		return redactedValue
+	}
+
+	var unmarshaled interface{}
+	if err := json.Unmarshal(marshaledData, &unmarshaled); err != nil {
+		return redactedValue
+	}
+
+	return redactFields(unmarshaled)
+}
+
+func redactFields(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key := range typed {
+			if isRedactedLogField(key) {
+				typed[key] = redactedValue
+				continue
+			}
+			typed[key] = redactFields(typed[key])
+		}
+	case []interface{}:
+		for i := range typed {
+			typed[i] = redactFields(typed[i])
+		}
+	}
+
+	return value
+}
+
+func isRedactedLogField(field string) bool {
+	for i := range config.RedactedLogFields {
+		if config.RedactedLogFields[i] == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+type releaseTransactionHoldsRequest struct {
+	Tenant        string `json:"tenant"`
+	TransactionID uint64 `json:"transaction_id"`
+}
+
+// HandleReleaseTransactionHoldsWithContext releases everything still
+// held on a transaction in one go, e.g. when settling a batch. a RELEASE
+// is played for what each of its holds has left, so the release is
+// valid whether or not the tenant releases specific holds.
+func HandleReleaseTransactionHoldsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received release transaction holds request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req releaseTransactionHoldsRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.Tenant == "" || req.TransactionID == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if !config.IsTenantAllowed(req.Tenant) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error tenant not allowed"))
+		return
+	}
+
+	logger.Infow("handling release transaction holds request", "request", redacted(req))
+	// the account is only known once the transaction is read,
+	// and the gate is held across attempts rather than per attempt
+	var gatedAccountID uint64
+	defer func() {
+		if gatedAccountID != 0 {
+			accountGate.Release(gatedAccountID)
+		}
+	}()
+
+	var result executeOperationsResponse
+	err := withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		transaction, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
+		if errors.Is(err, ErrNotFound) {
+			return earlyHTTPError(http.StatusNotFound, errors.New("error transaction not found"))
+		}
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+
+		if gatedAccountID == 0 {
+			if !accountGate.TryAcquire(transaction.AccountID) {
+				early := earlyHTTPError(http.StatusTooManyRequests, fmt.Errorf("error too many concurrent requests for account"))
+				early.retryAfter = config.ConcurrencyRetryAfter
+				return early
+			}
+			gatedAccountID = transaction.AccountID
+		}
+
+		account, err := LockAccountWithContext(ctx, tx, transaction.AccountID)
+		if err != nil {
+			return fmt.Errorf("error locking account: %w", err)
+		}
+
+		// read again under the account lock, holds may
+		// have been added or released in the meantime
+		transaction, err = GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+		if transaction.HeldAmountInCents <= 0 {
+			return earlyHTTPError(config.BusinessRejectionStatus, errors.New("error transaction has nothing held to release"))
+		}
+
+		holdOperations, err := GetTransactionHoldAndReleaseOperationsWithContext(ctx, tx, req.Tenant, req.TransactionID)
+		if err != nil {
+			return fmt.Errorf("error getting hold and release operations: %w", err)
+		}
+		operations := []Operation{}
+		for _, held := range OutstandingHolds(holdOperations) {
+			if held > 0 {
+				operations = append(operations, Operation{OperationType: "RELEASE", AmountInCents: held})
+			}
+		}
+		if len(operations) > config.MaxOperationsPerRequest {
+			return earlyHTTPError(config.BusinessRejectionStatus, fmt.Errorf("error too many holds to release, at most %d allowed", config.MaxOperationsPerRequest))
+		}
+
+		result, err = processExistingTransaction(ctx, tx, operations, account, transaction)
+		if errors.Is(err, ErrTransactionClosed) {
+			return earlyHTTPError(http.StatusConflict, ErrTransactionClosed)
+		}
+		if errors.Is(err, ErrAccountClosed) {
+			return earlyHTTPError(http.StatusConflict, ErrAccountClosed)
+		}
+		if errors.Is(err, ErrInvalidPlayOrderNegativeHold) || errors.Is(err, ErrAmountOverflow) || errors.Is(err, ErrTransactionOperationLimit) {
+			return earlyHTTPError(config.BusinessRejectionStatus, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error processing operations: %w", err)
+		}
+
+		return nil
+	})
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing release transaction holds request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("transaction holds released", "request", redacted(req), "result", redacted(result))
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling response for release transaction holds request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
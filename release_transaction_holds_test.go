@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandleReleaseTransactionHolds(t *testing.T) {
+	pool := testPool(t)
+
+	tests := []struct {
+		name       string
+		operations []operationRequest
+	}{
+		{name: "one hold", operations: []operationRequest{op("HOLD", 100)}},
+		{name: "several holds", operations: []operationRequest{op("HOLD", 100), op("HOLD", 50), op("HOLD", 25)}},
+		{name: "partly released and settled", operations: []operationRequest{op("HOLD", 100), op("HOLD", 50), op("RELEASE", 30), op("SETTLE", 20)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testAccount(t, pool)
+			testPlay(t, pool, account.AccountID, op("CREDIT", 1000))
+			// another transaction's hold, which stays held
+			testPlay(t, pool, account.AccountID, op("HOLD", 10))
+			played := testPlay(t, pool, account.AccountID, tt.operations...)
+			before := testGetAccount(t, pool, account.AccountID)
+
+			w := testRequest(t, HandleReleaseTransactionHoldsWithContext, pool, http.MethodPost, "/release_transaction_holds", releaseTransactionHoldsRequest{
+				Tenant:        testTenant,
+				TransactionID: played.Transaction.TransactionID,
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var res executeOperationsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+
+			if res.Transaction.HeldAmountInCents != 0 {
+				t.Errorf("expected nothing held on the transaction, got %d", res.Transaction.HeldAmountInCents)
+			}
+			released := played.Transaction.HeldAmountInCents
+			after := testGetAccount(t, pool, account.AccountID)
+			if after.RunningHeld != 10 || after.RunningHeld != before.RunningHeld-released {
+				t.Errorf("expected only the other transaction's 10 held, got %d", after.RunningHeld)
+			}
+			if after.RunningBalance != before.RunningBalance+released {
+				t.Errorf("expected the %d released back into the balance, got %d from %d", released, after.RunningBalance, before.RunningBalance)
+			}
+			if res.Account.RunningHeld != after.RunningHeld || res.Account.RunningBalance != after.RunningBalance {
+				t.Errorf("expected the committed account %+v, got %+v", after, res.Account)
+			}
+
+			// nothing left to release
+			w = testRequest(t, HandleReleaseTransactionHoldsWithContext, pool, http.MethodPost, "/release_transaction_holds", releaseTransactionHoldsRequest{
+				Tenant:        testTenant,
+				TransactionID: played.Transaction.TransactionID,
+			})
+			if w.Code != config.BusinessRejectionStatus {
+				t.Errorf("expected status %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleReleaseTransactionHoldsOperationLimit(t *testing.T) {
+	defer func(tenantConfigs map[string]TenantConfig) {
+		config.TenantConfigs = tenantConfigs
+	}(config.TenantConfigs)
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+	played := testPlay(t, pool, account.AccountID, op("HOLD", 40))
+	config.TenantConfigs = map[string]TenantConfig{testTenant: {MaxOperationsPerTransaction: 1}}
+
+	w := testRequest(t, HandleReleaseTransactionHoldsWithContext, pool, http.MethodPost, "/release_transaction_holds", releaseTransactionHoldsRequest{
+		Tenant:        testTenant,
+		TransactionID: played.Transaction.TransactionID,
+	})
+	if w.Code != config.BusinessRejectionStatus {
+		t.Fatalf("expected %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+	}
+	var errorRes errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errorRes); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if errorRes.Code != "TRANSACTION_OPERATION_LIMIT" {
+		t.Errorf("expected code TRANSACTION_OPERATION_LIMIT, got %s", errorRes.Code)
+	}
+}
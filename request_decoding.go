@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnknownField is returned decoding a request
+// naming a field the endpoint doesn't have.
+var ErrUnknownField = errors.New("error unknown field")
+
+// ErrRequestBodyTooLarge is returned decoding a request
+// body larger than Config.MaxRequestBodyBytes.
+var ErrRequestBodyTooLarge = errors.New("error request body too large")
+
+// limitRequestBody caps how much of the request body can be read, so
+// a huge body fails decoding once past the limit rather than being
+// read into memory whole ahead of the request being validated.
+func limitRequestBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(config.MaxRequestBodyBytes))
+		}
+
+		next(w, r)
+	}
+}
+
+// decodeRequestBody decodes the JSON body into req. fields req doesn't
+// have are rejected with ErrUnknownField naming the field, rather than
+// dropped, so a typo doesn't silently leave a field unset.
+func decodeRequestBody(body io.Reader, req interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(req)
+	if err != nil && isRequestBodyTooLargeError(err) {
+		return fmt.Errorf("%w, at most %d bytes allowed", ErrRequestBodyTooLarge, config.MaxRequestBodyBytes)
+	}
+	if err != nil && isUnknownFieldError(err) {
+		return fmt.Errorf("%w: %s", ErrUnknownField, strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	return err
+}
+
+// encoding/json has no error type for unknown fields to match on
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
+
+// nor does net/http for a body read past http.MaxBytesReader's limit
+func isRequestBodyTooLargeError(err error) bool {
+	return err.Error() == "http: request body too large"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequestBodyUnknownField(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "known fields", body: `{"user_ari":"ari:test"}`},
+		{name: "unknown field", body: `{"user_ari":"ari:test","junk":1}`, wantErr: ErrUnknownField},
+		{name: "misspelled field", body: `{"user_arn":"ari:test"}`, wantErr: ErrUnknownField},
+		{name: "unknown field only", body: `{"junk":true}`, wantErr: ErrUnknownField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req createAccountRequest
+			err := decodeRequestBody(strings.NewReader(tt.body), &req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil && decodeErrorStatus(err) != http.StatusUnprocessableEntity {
+				t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, decodeErrorStatus(err))
+			}
+		})
+	}
+}
+
+func TestDecodeRequestBodyNamesUnknownField(t *testing.T) {
+	var req createAccountRequest
+	err := decodeRequestBody(strings.NewReader(`{"user_ari":"ari:test","junk":1}`), &req)
+	if err == nil || !strings.Contains(err.Error(), `"junk"`) {
+		t.Errorf("expected the error to name the unknown field, got %v", err)
+	}
+}
+
+func TestLimitRequestBodyOversizedOperations(t *testing.T) {
+	defer func(maxRequestBodyBytes int) {
+		config.MaxRequestBodyBytes = maxRequestBodyBytes
+	}(config.MaxRequestBodyBytes)
+	config.MaxRequestBodyBytes = 4096
+
+	req := executeOperationsRequest{AccountID: 1, Tenant: testTenant}
+	for i := 0; i < 1000; i++ {
+		req.Operations = append(req.Operations, op("CREDIT", 1))
+	}
+
+	handler := limitRequestBody(func(w http.ResponseWriter, r *http.Request) {
+		// rejected before the pool is used
+		HandleExecuteOperationsWithContext(r.Context(), nil, w, r)
+	})
+	w := testRequest(t, func(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+	}, nil, http.MethodPost, "/execute_operations", req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"code":"REQUEST_BODY_TOO_LARGE"`) {
+		t.Errorf("expected code REQUEST_BODY_TOO_LARGE, got %s", w.Body.String())
+	}
+}
+
+func TestDecodeRequestBodyTooLarge(t *testing.T) {
+	body := http.MaxBytesReader(nil, ioutil.NopCloser(strings.NewReader(`{"user_ari":"`+strings.Repeat("a", 100)+`"}`)), 64)
+
+	var req createAccountRequest
+	err := decodeRequestBody(body, &req)
+	if !errors.Is(err, ErrRequestBodyTooLarge) {
+		t.Fatalf("expected ErrRequestBodyTooLarge, got %v", err)
+	}
+	if decodeErrorStatus(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, decodeErrorStatus(err))
+	}
+}
+
+func TestHandlersRejectUnknownFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(context.Context, *sql.DB, http.ResponseWriter, *http.Request)
+		target  string
+		body    string
+	}{
+		{
+			name:    "create account",
+			handler: HandleCreateAccountWithContext,
+			target:  "/create_account",
+			body:    `{"user_ari":"ari:test","junk":1}`,
+		},
+		{
+			name:    "execute operations",
+			handler: HandleExecuteOperationsWithContext,
+			target:  "/execute_operations",
+			body:    `{"account_id":1,"tenant":"test","operations":[{"operation_type":"CREDIT","amount_in_cents":1}],"junk":1}`,
+		},
+		{
+			name:    "execute operations with an unknown operation field",
+			handler: HandleExecuteOperationsWithContext,
+			target:  "/execute_operations",
+			body:    `{"account_id":1,"tenant":"test","operations":[{"operation_type":"CREDIT","amount_in_cents":1,"junk":1}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// rejected before the pool is used
+			w := testRequest(t, tt.handler, nil, http.MethodPost, tt.target, tt.body)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"code":"UNKNOWN_FIELD"`) {
+				t.Errorf("expected code UNKNOWN_FIELD, got %s", w.Body.String())
+			}
+		})
+	}
+}
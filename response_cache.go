@@ -0,0 +1,85 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ResponseCache is an LRU of marshaled responses, only ever
+// used for reads that can't change once written, such as
+// operations and transactions as of a played sequence.
+// a size of zero or less disables it.
+type ResponseCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type responseCacheEntry struct {
+	key   string
+	value []byte
+}
+
+var responseCache *ResponseCache
+
+func NewResponseCache(size int) *ResponseCache {
+	return &ResponseCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the endpoint's cached response for the key,
+// if any, recording the hit or miss against the endpoint.
+func (c *ResponseCache) Get(endpoint string, key string) ([]byte, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[responseCacheKey(endpoint, key)]
+	if !ok {
+		responseCacheRequests.WithLabelValues(endpoint, "miss").Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	responseCacheRequests.WithLabelValues(endpoint, "hit").Inc()
+
+	return element.Value.(*responseCacheEntry).value, true
+}
+
+// Add caches the endpoint's response for the key, evicting
+// the least recently used response when full.
+func (c *ResponseCache) Add(endpoint string, key string, value []byte) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key = responseCacheKey(endpoint, key)
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*responseCacheEntry).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&responseCacheEntry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// responseCacheKey keeps the endpoints' keys apart, they're
+// built from parameters, e.g. a tenant, that could make two
+// endpoints' keys the same.
+func responseCacheKey(endpoint string, key string) string {
+	return endpoint + "\x00" + key
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestResponseCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		add      [][2]string
+		get      []string
+		thenAdd  [][2]string
+		expected map[string]string
+	}{
+		{
+			name:     "cached",
+			size:     2,
+			add:      [][2]string{{"a", "1"}},
+			expected: map[string]string{"a": "1", "b": ""},
+		},
+		{
+			name:     "replaced",
+			size:     2,
+			add:      [][2]string{{"a", "1"}, {"a", "2"}},
+			expected: map[string]string{"a": "2"},
+		},
+		{
+			name:     "least recently added evicted",
+			size:     2,
+			add:      [][2]string{{"a", "1"}, {"b", "2"}, {"c", "3"}},
+			expected: map[string]string{"a": "", "b": "2", "c": "3"},
+		},
+		{
+			name:     "least recently read evicted",
+			size:     2,
+			add:      [][2]string{{"a", "1"}, {"b", "2"}},
+			get:      []string{"a"},
+			thenAdd:  [][2]string{{"c", "3"}},
+			expected: map[string]string{"a": "1", "b": "", "c": "3"},
+		},
+		{
+			name:     "disabled",
+			size:     0,
+			add:      [][2]string{{"a", "1"}},
+			expected: map[string]string{"a": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewResponseCache(tt.size)
+			for _, entry := range tt.add {
+				cache.Add("test", entry[0], []byte(entry[1]))
+			}
+			for _, key := range tt.get {
+				cache.Get("test", key)
+			}
+			for _, entry := range tt.thenAdd {
+				cache.Add("test", entry[0], []byte(entry[1]))
+			}
+
+			for key, expected := range tt.expected {
+				value, ok := cache.Get("test", key)
+				if ok != (expected != "") || string(value) != expected {
+					t.Errorf("expected %q cached as %q, got %q (%t)", key, expected, value, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCacheKeepsEndpointsApart(t *testing.T) {
+	cache := NewResponseCache(2)
+	cache.Add("get_operation", "test/1", []byte("operation"))
+
+	if value, ok := cache.Get("get_transaction", "test/1"); ok {
+		t.Errorf("expected no transaction cached, got %q", value)
+	}
+	if value, ok := cache.Get("get_operation", "test/1"); !ok || string(value) != "operation" {
+		t.Errorf("expected the operation cached, got %q (%t)", value, ok)
+	}
+}
+
+func TestHandleGetTransactionCache(t *testing.T) {
+	defer func(cache *ResponseCache) {
+		responseCache = cache
+	}(responseCache)
+	responseCache = NewResponseCache(10)
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+	transactionID := played.Transaction.TransactionID
+
+	get := func(query string) string {
+		target := fmt.Sprintf("/get_transaction?tenant=%s&transaction_id=%d%s", testTenant, transactionID, query)
+		w := testRequest(t, HandleGetTransactionWithContext, pool, http.MethodGet, target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	asOfFirst := get("&as_of_sequence=1")
+	// not played up to yet, so it's not cached
+	asOfSecond := get("&as_of_sequence=2")
+	now := get("")
+
+	testPlayOnTransaction(t, pool, account.AccountID, transactionID, op("CREDIT", 50))
+
+	if got := get("&as_of_sequence=1"); got != asOfFirst {
+		t.Errorf("expected the transaction as of sequence 1 unchanged, got %s, expected %s", got, asOfFirst)
+	}
+	if got := get("&as_of_sequence=2"); got == asOfSecond {
+		t.Errorf("expected the transaction as of sequence 2 to include the operation played since, got %s", got)
+	}
+	if got := get(""); got == now {
+		t.Errorf("expected the transaction now to include the operation played since, got %s", got)
+	}
+}
+
+func TestHandleGetOperationCache(t *testing.T) {
+	defer func(cache *ResponseCache) {
+		responseCache = cache
+	}(responseCache)
+	responseCache = NewResponseCache(10)
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+
+	target := fmt.Sprintf("/get_operation?tenant=%s&operation_id=%d", testTenant, played.Operations[0].OperationID)
+	first := testRequest(t, HandleGetOperationWithContext, pool, http.MethodGet, target, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", first.Code, first.Body.String())
+	}
+	// served from the cache, the nil pool is never used
+	second := testRequest(t, HandleGetOperationWithContext, nil, http.MethodGet, target, nil)
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("expected the cached %s, got %d: %s", first.Body.String(), second.Code, second.Body.String())
+	}
+	// a missing operation isn't cached
+	missing := fmt.Sprintf("/get_operation?tenant=%s&operation_id=%d", testTenant, played.Operations[0].OperationID+1<<40)
+	if w := testRequest(t, HandleGetOperationWithContext, pool, http.MethodGet, missing, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := responseCache.Get("get_operation", fmt.Sprintf("%s/%d", testTenant, played.Operations[0].OperationID+1<<40)); ok {
+		t.Errorf("expected the missing operation not to be cached")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// the operations undoing each operation type, in the order they're played
+var inverseOperationTypes = map[string][]string{
+	"HOLD":    {"RELEASE"},
+	"RELEASE": {"HOLD"},
+	"DEBIT":   {"CREDIT"},
+	"CREDIT":  {"DEBIT"},
+	// the settled amount is returned to the balance and held again,
+	// for the reversal of the HOLD it settled to release
+	"SETTLE": {"CREDIT", "HOLD"},
+}
+
+type reverseTransactionRequest struct {
+	Tenant        string `json:"tenant"`
+	TransactionID uint64 `json:"transaction_id"`
+}
+
+type reverseTransactionMetadata struct {
+	ReversalOf struct {
+		TransactionID uint64 `json:"transaction_id"`
+		OperationID   uint64 `json:"operation_id"`
+	} `json:"reversal_of"`
+}
+
+// HandleReverseTransactionWithContext undoes a transaction by playing
+// the inverse of each of its operations, most recent first, as a new
+// transaction on the same account. fees charged on the transaction
+// are kept, they're for operations that were played and aren't
+// refunded by undoing them. only transactions with nothing
+// left held can be reversed, since holds are tracked per transaction
+// and releasing them from the reversal would leave it negatively held,
+// and only once, a transaction already reversed is rejected with a 409.
+func HandleReverseTransactionWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received reverse transaction request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req reverseTransactionRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.Tenant == "" || req.TransactionID == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if !config.IsTenantAllowed(req.Tenant) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error tenant not allowed"))
+		return
+	}
+
+	logger.Infow("handling reverse transaction request", "request", redacted(req))
+	// the account is only known once the transaction is read,
+	// and the gate is held across attempts rather than per attempt
+	var gatedAccountID uint64
+	defer func() {
+		if gatedAccountID != 0 {
+			accountGate.Release(gatedAccountID)
+		}
+	}()
+
+	var result executeOperationsResponse
+	err := withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		transaction, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.TransactionID)
+		if errors.Is(err, ErrNotFound) {
+			return earlyHTTPError(http.StatusNotFound, errors.New("error transaction not found"))
+		}
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+
+		if gatedAccountID == 0 {
+			if !accountGate.TryAcquire(transaction.AccountID) {
+				early := earlyHTTPError(http.StatusTooManyRequests, fmt.Errorf("error too many concurrent requests for account"))
+				early.retryAfter = config.ConcurrencyRetryAfter
+				return early
+			}
+			gatedAccountID = transaction.AccountID
+		}
+
+		account, err := LockAccountWithContext(ctx, tx, transaction.AccountID)
+		if err != nil {
+			return fmt.Errorf("error locking account: %w", err)
+		}
+
+		// read again under the account lock, operations may
+		// have been added to the transaction in the meantime.
+		// the reversal is itself a request's worth of operations.
+		original, err := GetTransactionAndOperationsWithContext(ctx, tx, req.Tenant, req.TransactionID, config.MaxOperationsPerRequest, OperationsFilter{})
+		if err != nil {
+			return fmt.Errorf("error getting operations: %w", err)
+		}
+		if original.Truncated {
+			return earlyHTTPError(config.BusinessRejectionStatus, fmt.Errorf("error too many operations to reverse, at most %d allowed", config.MaxOperationsPerRequest))
+		}
+		// a retried or repeated request would otherwise play
+		// the inverse operations again, checked under the lock
+		// so two concurrent reversals can't both get through
+		reversed, err := IsTransactionReversedWithContext(ctx, tx, req.Tenant, req.TransactionID)
+		if err != nil {
+			return fmt.Errorf("error checking transaction reversals: %w", err)
+		}
+		if reversed {
+			return earlyHTTPError(http.StatusConflict, ErrTransactionAlreadyReversed)
+		}
+		if original.Transaction.HeldAmountInCents != 0 {
+			return earlyHTTPError(config.BusinessRejectionStatus, errors.New("error transaction has outstanding holds, release them before reversing"))
+		}
+
+		operations, err := reversingOperations(original.Operations)
+		if err != nil {
+			return fmt.Errorf("error building reversing operations: %w", err)
+		}
+
+		result, err = processNewTransaction(ctx, tx, req.Tenant, operations, account)
+		if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) || errors.Is(err, ErrInvalidPlayOrderNegativeHold) || errors.Is(err, ErrAmountOverflow) || errors.Is(err, ErrTooManyActiveHolds) || errors.Is(err, ErrTransactionOperationLimit) {
+			return earlyHTTPError(config.BusinessRejectionStatus, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error processing operations: %w", err)
+		}
+
+		return nil
+	})
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing reverse transaction request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("transaction reversed", "request", redacted(req), "result", redacted(result))
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling response for reverse transaction request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// reversingOperations inverts each of the operations but the fees,
+// which must be ordered most recent first, recording in the metadata
+// of each inverse the operation it reverses. played in that order
+// the reversal is never held negatively as long as the original
+// transaction ended with nothing held.
+func reversingOperations(operations []Operation) ([]Operation, error) {
+	reversing := make([]Operation, 0, len(operations))
+	for i := range operations {
+		if isFeeOperation(operations[i]) {
+			continue
+		}
+		inverseTypes, ok := inverseOperationTypes[operations[i].OperationType]
+		if !ok {
+			return nil, fmt.Errorf("error unknown operation type %q", operations[i].OperationType)
+		}
+
+		var metadata reverseTransactionMetadata
+		metadata.ReversalOf.TransactionID = operations[i].TransactionID
+		metadata.ReversalOf.OperationID = operations[i].OperationID
+		marshaledMetadata, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling metadata: %w", err)
+		}
+
+		for _, inverseType := range inverseTypes {
+			reversing = append(reversing, Operation{OperationType: inverseType, AmountInCents: operations[i].AmountInCents, Metadata: marshaledMetadata})
+		}
+	}
+
+	return reversing, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestReversingOperations(t *testing.T) {
+	operations := []Operation{
+		{OperationID: 4, TransactionID: 1, OperationType: "DEBIT", AmountInCents: 3, Metadata: json.RawMessage(`{"fee":{"operation_type":"SETTLE","amount_in_cents":30,"flat_in_cents":3,"basis_points":0}}`)},
+		{OperationID: 3, TransactionID: 1, OperationType: "SETTLE", AmountInCents: 30},
+		{OperationID: 2, TransactionID: 1, OperationType: "DEBIT", AmountInCents: 20},
+		{OperationID: 1, TransactionID: 1, OperationType: "CREDIT", AmountInCents: 100},
+	}
+
+	reversing, err := reversingOperations(operations)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []struct {
+		operationType string
+		reversalOf    uint64
+	}{
+		{"CREDIT", 3},
+		{"HOLD", 3},
+		{"CREDIT", 2},
+		{"DEBIT", 1},
+	}
+	if len(reversing) != len(expected) {
+		t.Fatalf("expected %d reversing operations, got %d", len(expected), len(reversing))
+	}
+	for i := range expected {
+		var metadata reverseTransactionMetadata
+		if err := json.Unmarshal(reversing[i].Metadata, &metadata); err != nil {
+			t.Fatalf("error unmarshaling metadata: %s", err)
+		}
+		if reversing[i].OperationType != expected[i].operationType || metadata.ReversalOf.OperationID != expected[i].reversalOf {
+			t.Errorf("operation %d: expected %s reversing %d, got %s reversing %d", i, expected[i].operationType, expected[i].reversalOf, reversing[i].OperationType, metadata.ReversalOf.OperationID)
+		}
+	}
+}
+
+func TestReversingOperationsUnknownType(t *testing.T) {
+	if _, err := reversingOperations([]Operation{{OperationType: "REFUND", AmountInCents: 1}}); err == nil {
+		t.Fatal("expected an unknown operation type to fail")
+	}
+}
+
+func TestHandleReverseTransactionOnlyOnce(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 40))
+
+	req := reverseTransactionRequest{Tenant: testTenant, TransactionID: played.Transaction.TransactionID}
+	w := testRequest(t, HandleReverseTransactionWithContext, pool, http.MethodPost, "/reverse_transaction", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the reversal to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var reversed executeOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reversed); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if reversed.Account.RunningBalance != 0 {
+		t.Errorf("expected the reversal to return the balance to 0, got %d", reversed.Account.RunningBalance)
+	}
+
+	w = testRequest(t, HandleReverseTransactionWithContext, pool, http.MethodPost, "/reverse_transaction", req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected reversing again to conflict, got %d: %s", w.Code, w.Body.String())
+	}
+	var errorRes errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errorRes); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if errorRes.Code != "TRANSACTION_ALREADY_REVERSED" {
+		t.Errorf("expected code TRANSACTION_ALREADY_REVERSED, got %s", errorRes.Code)
+	}
+	if balance := testGetAccount(t, pool, account.AccountID).RunningBalance; balance != 0 {
+		t.Errorf("expected the balance to stay at 0, got %d", balance)
+	}
+}
+
+func TestHandleReverseTransactionKeepsFees(t *testing.T) {
+	defer func(tenantConfigs map[string]TenantConfig) {
+		config.TenantConfigs = tenantConfigs
+	}(config.TenantConfigs)
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+	config.TenantConfigs = map[string]TenantConfig{testTenant: {Fees: map[string]FeeSchedule{"DEBIT": {FlatInCents: 5}}}}
+	played := testPlay(t, pool, account.AccountID, op("DEBIT", 40))
+	if played.Account.RunningBalance != 55 {
+		t.Fatalf("expected the debit and its fee to leave 55, got %d", played.Account.RunningBalance)
+	}
+
+	req := reverseTransactionRequest{Tenant: testTenant, TransactionID: played.Transaction.TransactionID}
+	w := testRequest(t, HandleReverseTransactionWithContext, pool, http.MethodPost, "/reverse_transaction", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the reversal to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var reversed executeOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reversed); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if reversed.Account.RunningBalance != 95 {
+		t.Errorf("expected the reversal to refund the debit but not its fee, leaving 95, got %d", reversed.Account.RunningBalance)
+	}
+}
+
+func TestHandleReverseTransactionNegativeBalance(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	credited := testPlay(t, pool, account.AccountID, op("CREDIT", 100))
+	testPlay(t, pool, account.AccountID, op("DEBIT", 100))
+
+	req := reverseTransactionRequest{Tenant: testTenant, TransactionID: credited.Transaction.TransactionID}
+	w := testRequest(t, HandleReverseTransactionWithContext, pool, http.MethodPost, "/reverse_transaction", req)
+	if w.Code != config.BusinessRejectionStatus {
+		t.Fatalf("expected %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+	}
+}
+
+func TestHandleReverseTransactionOperationLimit(t *testing.T) {
+	defer func(tenantConfigs map[string]TenantConfig) {
+		config.TenantConfigs = tenantConfigs
+	}(config.TenantConfigs)
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 40))
+	config.TenantConfigs = map[string]TenantConfig{testTenant: {MaxOperationsPerTransaction: 1}}
+
+	req := reverseTransactionRequest{Tenant: testTenant, TransactionID: played.Transaction.TransactionID}
+	w := testRequest(t, HandleReverseTransactionWithContext, pool, http.MethodPost, "/reverse_transaction", req)
+	if w.Code != config.BusinessRejectionStatus {
+		t.Fatalf("expected %d, got %d: %s", config.BusinessRejectionStatus, w.Code, w.Body.String())
+	}
+	var errorRes errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errorRes); err != nil {
+		t.Fatalf("error unmarshaling response: %s", err)
+	}
+	if errorRes.Code != "TRANSACTION_OPERATION_LIMIT" {
+		t.Errorf("expected code TRANSACTION_OPERATION_LIMIT, got %s", errorRes.Code)
+	}
+}
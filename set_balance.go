@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+type setBalanceRequest struct {
+	AccountID            uint64 `json:"account_id"`
+	Tenant               string `json:"tenant"`
+	TargetBalanceInCents int64  `json:"target_balance_in_cents"`
+	AllowNegativeBalance bool   `json:"allow_negative_balance"`
+}
+
+type setBalanceMetadata struct {
+	SetBalance struct {
+		TargetBalanceInCents   int64 `json:"target_balance_in_cents"`
+		PreviousBalanceInCents int64 `json:"previous_balance_in_cents"`
+		DeltaInCents           int64 `json:"delta_in_cents"`
+	} `json:"set_balance"`
+}
+
+// HandleSetBalanceWithContext brings an account's balance to an
+// absolute target. rather than overwriting the balance, it plays
+// the credit or debit needed to get there, so the event trail
+// still adds up to the account's running balance.
+func HandleSetBalanceWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received set balance request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req setBalanceRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.Tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if !accountGate.TryAcquire(req.AccountID) {
+		writeRetryableHTTPError(w, http.StatusTooManyRequests, config.ConcurrencyRetryAfter, fmt.Errorf("error too many concurrent requests for account"))
+		return
+	}
+	defer accountGate.Release(req.AccountID)
+
+	logger.Infow("handling set balance request", "request", redacted(req))
+	var delta int64
+	var result executeOperationsResponse
+	err := withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		account, err := LockAccountWithContext(ctx, tx, req.AccountID)
+		if err != nil {
+			return fmt.Errorf("error locking account: %w", err)
+		}
+		// within the account's overdraft limit, a negative target is fine
+		if req.TargetBalanceInCents < -account.OverdraftLimitInCents && !req.AllowNegativeBalance {
+			return earlyHTTPError(http.StatusBadRequest, ErrInvalidPlayOrderNegativeBalance)
+		}
+
+		result = executeOperationsResponse{Account: account}
+		var operation Operation
+		operation, delta, err = setBalanceOperation(account.RunningBalance, req.TargetBalanceInCents)
+		if errors.Is(err, ErrAmountOverflow) {
+			return earlyHTTPError(config.BusinessRejectionStatus, err)
+		}
+		if err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+
+		options := PlayOptions{AllowNegativeBalance: req.AllowNegativeBalance}
+		result, err = processNewTransactionWithOptions(ctx, tx, req.Tenant, []Operation{operation}, account, options)
+		if errors.Is(err, ErrInvalidPlayOrderNegativeBalance) || errors.Is(err, ErrAmountOverflow) || errors.Is(err, ErrTransactionOperationLimit) {
+			return earlyHTTPError(config.BusinessRejectionStatus, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error processing operations: %w", err)
+		}
+
+		return nil
+	})
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing set balance request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("balance set", "request", redacted(req), "delta", delta, "result", redacted(result))
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling response for set balance request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// setBalanceOperation is the operation bringing the balance to the
+// target, with the delta it plays, none when it's already there.
+// the delta, and the amount debited for a negative one, must fit
+// in an int64, failing with ErrAmountOverflow otherwise.
+func setBalanceOperation(previousBalanceInCents int64, targetBalanceInCents int64) (Operation, int64, error) {
+	delta, ok := subtractInt64(targetBalanceInCents, previousBalanceInCents)
+	if !ok {
+		return Operation{}, 0, ErrAmountOverflow
+	}
+	if delta == 0 {
+		return Operation{}, 0, nil
+	}
+
+	var metadata setBalanceMetadata
+	metadata.SetBalance.TargetBalanceInCents = targetBalanceInCents
+	metadata.SetBalance.PreviousBalanceInCents = previousBalanceInCents
+	metadata.SetBalance.DeltaInCents = delta
+	marshaledMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return Operation{}, 0, fmt.Errorf("error marshaling metadata: %w", err)
+	}
+
+	if delta > 0 {
+		return Operation{OperationType: "CREDIT", AmountInCents: delta, Metadata: marshaledMetadata}, delta, nil
+	}
+	debit, ok := subtractInt64(0, delta)
+	if !ok {
+		return Operation{}, 0, ErrAmountOverflow
+	}
+
+	return Operation{OperationType: "DEBIT", AmountInCents: debit, Metadata: marshaledMetadata}, delta, nil
+}
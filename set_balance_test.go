@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSetBalanceOperation(t *testing.T) {
+	tests := []struct {
+		name            string
+		previousBalance int64
+		targetBalance   int64
+		wantType        string
+		wantAmount      int64
+		wantDelta       int64
+		wantErr         error
+	}{
+		{name: "already at target", previousBalance: 100, targetBalance: 100},
+		{name: "credit up to target", previousBalance: 100, targetBalance: 250, wantType: "CREDIT", wantAmount: 150, wantDelta: 150},
+		{name: "debit down to target", previousBalance: 100, targetBalance: -50, wantType: "DEBIT", wantAmount: 150, wantDelta: -150},
+		{name: "credit to the largest balance", previousBalance: 0, targetBalance: math.MaxInt64, wantType: "CREDIT", wantAmount: math.MaxInt64, wantDelta: math.MaxInt64},
+		{name: "delta overflows", previousBalance: -1, targetBalance: math.MaxInt64, wantErr: ErrAmountOverflow},
+		{name: "delta underflows", previousBalance: 1, targetBalance: math.MinInt64, wantErr: ErrAmountOverflow},
+		// the delta fits, but the amount to debit doesn't
+		{name: "debit overflows", previousBalance: 0, targetBalance: math.MinInt64, wantErr: ErrAmountOverflow},
+		{name: "largest debit", previousBalance: 0, targetBalance: math.MinInt64 + 1, wantType: "DEBIT", wantAmount: math.MaxInt64, wantDelta: math.MinInt64 + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation, delta, err := setBalanceOperation(tt.previousBalance, tt.targetBalance)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if delta != tt.wantDelta {
+				t.Errorf("expected delta %d, got %d", tt.wantDelta, delta)
+			}
+			if operation.OperationType != tt.wantType || operation.AmountInCents != tt.wantAmount {
+				t.Errorf("expected %s of %d, got %s of %d", tt.wantType, tt.wantAmount, operation.OperationType, operation.AmountInCents)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+type setOverdraftLimitRequest struct {
+	AccountID             uint64 `json:"account_id"`
+	OverdraftLimitInCents int64  `json:"overdraft_limit_in_cents"`
+}
+
+// HandleSetOverdraftLimitWithContext sets how far below zero an account's
+// balance may be played, zero, the default, allowing no overdraft at all.
+func HandleSetOverdraftLimitWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received set overdraft limit request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req setOverdraftLimitRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.AccountID == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if req.OverdraftLimitInCents < 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error invalid overdraft_limit_in_cents, must not be negative"))
+		return
+	}
+
+	logger.Infow("handling set overdraft limit request", "request", redacted(req))
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Errorf("error beginning set overdraft limit transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	account, err := SetAccountOverdraftLimitWithContext(ctx, tx, req.AccountID, req.OverdraftLimitInCents)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error account not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing set overdraft limit database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("error committing set overdraft limit database state: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error committing database state: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledAccount, err := json.Marshal(account)
+	if err != nil {
+		logger.Errorf("error marshaling set overdraft limit response: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("overdraft limit set", "request", redacted(req), "account", redacted(account))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledAccount)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// set once shutdown begins, from then on new requests are turned
+// away while the ones in flight are given the chance to finish
+var draining int32
+
+func startDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// rejectWhileDraining turns requests away with a 503 once
+// the server is draining, readiness checks included, so
+// they're sent to another instance rather than cut short.
+func rejectWhileDraining(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isDraining() {
+			w.Header().Set("Content-Type", "application/json")
+			writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, errors.New("error server shutting down"))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	maxSimulatedAccounts = 1000
+	// accounts simulated at once, each holding a pool connection
+	simulationConcurrency = 4
+)
+
+// ends each account's simulation, so it's rolled back once played
+var errSimulated = errors.New("simulated, rolled back")
+
+type simulateOperationsRequest struct {
+	Tenant     string             `json:"tenant"`
+	AccountIDs []uint64           `json:"account_ids"`
+	Operations []operationRequest `json:"operations"`
+	// optional, the unit the operation amounts are in, cents by default
+	AmountUnit string `json:"amount_unit,omitempty"`
+}
+
+type simulateOperationsResult struct {
+	AccountID uint64 `json:"account_id"`
+	Succeeded bool   `json:"succeeded"`
+	executeOperationsResponse
+}
+
+type simulateOperationsResponse struct {
+	// always set, nothing in the response was persisted
+	Simulated bool                       `json:"simulated"`
+	Results   []simulateOperationsResult `json:"results"`
+}
+
+// HandleSimulateOperationsWithContext plays the same operations against each
+// of the accounts on a new transaction, returning the states they'd project
+// to and the accounts they'd be rejected for. like a dry run, each account is
+// locked and played exactly as a real request would be, in a database
+// transaction of its own that's then rolled back.
+func HandleSimulateOperationsWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received simulate operations request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req simulateOperationsRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if len(req.AccountIDs) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if len(req.AccountIDs) > maxSimulatedAccounts {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error too many accounts, at most %d allowed per simulation", maxSimulatedAccounts))
+		return
+	}
+	// validated as the request each account is simulated with
+	executeReq := executeOperationsRequest{Tenant: req.Tenant, Operations: req.Operations, AmountUnit: req.AmountUnit}
+	if err := executeReq.ConvertAmountsToCents(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := executeReq.Validate(); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logger.Infow("handling simulate operations request", "request", redacted(req))
+	results := make([]simulateOperationsResult, len(req.AccountIDs))
+	slots := make(chan struct{}, simulationConcurrency)
+	var wg sync.WaitGroup
+	for i := range req.AccountIDs {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			accountReq := executeReq
+			accountReq.AccountID = req.AccountIDs[i]
+			results[i] = simulateAccountOperations(ctx, pool, accountReq)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		logger.Errorf("error executing simulate operations database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	marshaledData, err := json.Marshal(simulateOperationsResponse{Simulated: true, Results: results})
+	if err != nil {
+		logger.Errorf("error marshaling response for simulate operations request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("operations simulated", "request", redacted(req), "results", redacted(results))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// simulateAccountOperations plays the request's operations against its
+// account, always rolling back. the account failing to play, for any
+// reason, is reported in the result.
+func simulateAccountOperations(ctx context.Context, pool *sql.DB, req executeOperationsRequest) simulateOperationsResult {
+	var result executeOperationsResponse
+	err := runTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		var err error
+		result, err = executeOperationsInTransaction(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+
+		return errSimulated
+	})
+	if errors.Is(err, errSimulated) {
+		result.DryRun = true
+		return simulateOperationsResult{AccountID: req.AccountID, Succeeded: true, executeOperationsResponse: result}
+	}
+
+	logger.Infow("simulated account failed", "request", redacted(req), "error", err)
+	return simulateOperationsResult{AccountID: req.AccountID, executeOperationsResponse: executeOperationsResponse{Error: err.Error(), Code: errorCode(config.BusinessRejectionStatus, err)}}
+}
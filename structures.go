@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"time"
 )
 
 type TxOp int64
@@ -12,12 +15,33 @@ const (
 	Release
 	Debit
 	Credit
+	// captures held funds, a RELEASE and DEBIT of the amount in one
+	Settle
 )
 
 var ErrInvalidPlayOrderNegativeBalance = errors.New("invalid order of operations, results in negative account balance")
 var ErrInvalidPlayOrderNegativeHold = errors.New("invalid order of operations, results in negatively held amount")
 var ErrAccountOperationLimit = errors.New("account limit on operations reached")
 var ErrTransactionOperationLimit = errors.New("transaction limit on operations reached")
+var ErrTransactionAccountMismatch = errors.New("transaction belongs to a different account")
+var ErrInsufficientFunds = errors.New("insufficient funds, available balance doesn't cover the hold")
+var ErrUnknownOperationType = errors.New("unknown operation type")
+var ErrAmountOverflow = errors.New("amount overflow, results in an amount too large to represent")
+var ErrIdempotencyKeyReused = errors.New("error idempotency_key already used for a different request")
+var ErrTransactionClosed = errors.New("transaction is older than the tenant allows, no more operations can be added")
+var ErrAccountClosed = errors.New("account is closed, no more operations can be played")
+var ErrTooManyActiveHolds = errors.New("account has as many active holds as the tenant allows")
+var ErrEventSequenceGap = errors.New("error events don't carry on the account's log from its last played sequence")
+var ErrAccountingInconsistency = errors.New("accounting inconsistency, account held amount disagrees with its transactions")
+var ErrAccountNotEmpty = errors.New("account can only be closed with nothing left in its balance or held")
+var ErrTransactionAlreadyReversed = errors.New("transaction has already been reversed")
+
+// wraps ErrInvalidPlayOrderNegativeBalance, the fee is what overdraws
+var ErrFeeNegativeBalance = fmt.Errorf("fee results in negative account balance: %w", ErrInvalidPlayOrderNegativeBalance)
+
+// wraps ErrInvalidPlayOrderNegativeHold, the release is more than
+// any one hold has left even if the holds together cover it
+var ErrReleaseExceedsHold = fmt.Errorf("release exceeds every outstanding hold: %w", ErrInvalidPlayOrderNegativeHold)
 
 // most sql drivers and go's native driver definitely
 // do not support setting the high bit, so realistically,
@@ -36,8 +60,18 @@ type Account struct {
 	LastPlayedSequence int64  `json:"last_played_sequence"`
 	RunningBalance     int64  `json:"running_balance"`
 	RunningHeld        int64  `json:"running_held"`
+	// see accountStatusOpen and accountStatusClosed
+	Status string `json:"status"`
+	// how far below zero RunningBalance may be played
+	OverdraftLimitInCents int64 `json:"overdraft_limit_in_cents"`
 }
 
+const (
+	accountStatusOpen = "open"
+	// set by close_account, and never unset
+	accountStatusClosed = "closed"
+)
+
 type PlayedOutcome struct {
 	PlayedAccount     Account
 	PlayedTransaction Transaction
@@ -45,17 +79,39 @@ type PlayedOutcome struct {
 	PlayedEvents      []Event
 }
 
+// PlayOptions relaxes the invariants enforced while playing,
+// the zero value enforces all of them.
+type PlayOptions struct {
+	// only ever set by admin corrections
+	AllowNegativeBalance bool
+	// a RELEASE must be covered by a single hold of the transaction
+	// rather than by all of them together, see OutstandingHolds
+	ReleaseSpecificHolds bool
+	// what each hold of the transaction has left before
+	// playing, oldest first. only used with ReleaseSpecificHolds
+	OutstandingHolds []int64
+	// the most operations the transaction can have, fees
+	// included, once played. zero only stops it wrapping around
+	MaxOperationsPerTransaction int64
+}
+
 // the concept of atomically  playing multiple operations in a single
 // API call only extends to a single transaction. this is intentional.
 // while it might be cute to extend this across transaction boundaries,
 // realistically, it makes little sense for related operations to be
 // spread out across multiple transactions.
 func (account Account) Play(transaction Transaction, operations []Operation) (PlayedOutcome, error) {
+	return account.PlayWithOptions(transaction, operations, PlayOptions{})
+}
+
+func (account Account) PlayWithOptions(transaction Transaction, operations []Operation, options PlayOptions) (PlayedOutcome, error) {
 	// primitives only, copied by value
 	playedTransaction := transaction
 	playedAccount := account
 	playedOperations := make([]Operation, len(operations))
 	playedEvents := make([]Event, len(playedOperations))
+	// copied, the caller's holds are left as they were
+	outstandingHolds := append([]int64(nil), options.OutstandingHolds...)
 
 	//logger.Infow("playing operations", "account", account, "transaction", transaction, "operations", operations)
 
@@ -68,44 +124,82 @@ func (account Account) Play(transaction Transaction, operations []Operation) (Pl
 		if err != nil {
 			return PlayedOutcome{}, fmt.Errorf("error getting operation type: %w", err)
 		}
+		// the played copies are discarded when
+		// an overflow is detected, nothing is half played
+		amount := playedOperation.AmountInCents
+		overflowed := false
+		add := func(a int64, b int64) int64 {
+			sum, ok := addInt64(a, b)
+			overflowed = overflowed || !ok
+			return sum
+		}
+		subtract := func(a int64, b int64) int64 {
+			difference, ok := subtractInt64(a, b)
+			overflowed = overflowed || !ok
+			return difference
+		}
 		switch operationType {
 		case Hold:
-			playedTransaction.HeldAmountInCents += playedOperation.AmountInCents
-			playedAccount.RunningHeld += playedOperation.AmountInCents
-			playedAccount.RunningBalance -= playedOperation.AmountInCents
+			outstandingHolds = append(outstandingHolds, amount)
+			playedTransaction.HeldAmountInCents = add(playedTransaction.HeldAmountInCents, amount)
+			playedAccount.RunningHeld = add(playedAccount.RunningHeld, amount)
+			playedAccount.RunningBalance = subtract(playedAccount.RunningBalance, amount)
 		case Release:
-			playedTransaction.HeldAmountInCents -= playedOperation.AmountInCents
-			playedAccount.RunningHeld -= playedOperation.AmountInCents
-			playedAccount.RunningBalance += playedOperation.AmountInCents
+			if options.ReleaseSpecificHolds && !releaseFromHold(outstandingHolds, amount) {
+				return PlayedOutcome{}, fmt.Errorf("error playing operation %d, RELEASE of %d cents: %w", i, amount, ErrReleaseExceedsHold)
+			}
+			playedTransaction.HeldAmountInCents = subtract(playedTransaction.HeldAmountInCents, amount)
+			playedAccount.RunningHeld = subtract(playedAccount.RunningHeld, amount)
+			playedAccount.RunningBalance = add(playedAccount.RunningBalance, amount)
+		case Settle:
+			// the hold already took the amount out of the balance,
+			// settling it only stops it being held
+			if options.ReleaseSpecificHolds && !releaseFromHold(outstandingHolds, amount) {
+				return PlayedOutcome{}, fmt.Errorf("error playing operation %d, SETTLE of %d cents: %w", i, amount, ErrReleaseExceedsHold)
+			}
+			playedTransaction.HeldAmountInCents = subtract(playedTransaction.HeldAmountInCents, amount)
+			playedTransaction.DebitedAmountInCents = add(playedTransaction.DebitedAmountInCents, amount)
+			playedAccount.RunningHeld = subtract(playedAccount.RunningHeld, amount)
 		case Debit:
-			playedTransaction.DebitedAmountInCents += playedOperation.AmountInCents
-			playedAccount.RunningBalance -= playedOperation.AmountInCents
+			playedTransaction.DebitedAmountInCents = add(playedTransaction.DebitedAmountInCents, amount)
+			playedAccount.RunningBalance = subtract(playedAccount.RunningBalance, amount)
 		case Credit:
-			playedTransaction.CreditedAmountInCents += playedOperation.AmountInCents
-			playedAccount.RunningBalance += playedOperation.AmountInCents
+			playedTransaction.CreditedAmountInCents = add(playedTransaction.CreditedAmountInCents, amount)
+			playedAccount.RunningBalance = add(playedAccount.RunningBalance, amount)
 		default:
-			continue
+			// nothing is played, a transaction missing
+			// one of its operations would corrupt the events
+			return PlayedOutcome{}, fmt.Errorf("error playing operation %d of type %q: %w", i, playedOperation.OperationType, ErrUnknownOperationType)
+		}
+		if overflowed {
+			return PlayedOutcome{}, ErrAmountOverflow
 		}
 
-		if playedAccount.RunningBalance < 0 {
+		if playedAccount.RunningBalance < -account.OverdraftLimitInCents && !options.AllowNegativeBalance {
+			if playedOperation.fee {
+				return PlayedOutcome{}, ErrFeeNegativeBalance
+			}
 			return PlayedOutcome{}, ErrInvalidPlayOrderNegativeBalance
 		}
 		if playedAccount.RunningHeld < 0 {
 			if playedTransaction.HeldAmountInCents >= 0 {
-				logger.Fatalf("accounting inconsistency, triage needed")
+				logger.Errorw("accounting inconsistency, triage needed", "account", redacted(account), "transaction", redacted(transaction), "operation_index", i, "operation", redacted(playedOperation), "running_held", playedAccount.RunningHeld, "transaction_held_amount_in_cents", playedTransaction.HeldAmountInCents)
+				return PlayedOutcome{}, fmt.Errorf("error playing operation %d, account %d held %d cents with transaction %d holding %d: %w", i, account.AccountID, playedAccount.RunningHeld, transaction.TransactionID, playedTransaction.HeldAmountInCents, ErrAccountingInconsistency)
 			}
 		}
 		if playedTransaction.HeldAmountInCents < 0 {
 			return PlayedOutcome{}, ErrInvalidPlayOrderNegativeHold
 		}
-		// signed wraparound
-		if playedAccount.LastPlayedSequence < 0 {
+		// checked ahead of the increments below
+		if playedAccount.LastPlayedSequence == math.MaxInt64 {
 			return PlayedOutcome{}, ErrAccountOperationLimit
 		}
-		// signed wraparound
-		if playedTransaction.LastPlayedSequence < 0 {
+		if playedTransaction.LastPlayedSequence == math.MaxInt64 {
 			return PlayedOutcome{}, ErrTransactionOperationLimit
 		}
+		if options.MaxOperationsPerTransaction > 0 && playedTransaction.LastPlayedSequence >= options.MaxOperationsPerTransaction {
+			return PlayedOutcome{}, fmt.Errorf("error playing operation %d, transaction already has %d operations: %w", i, playedTransaction.LastPlayedSequence, ErrTransactionOperationLimit)
+		}
 
 		playedAccount.LastPlayedSequence += 1
 		playedTransaction.LastPlayedSequence += 1
@@ -117,6 +211,7 @@ func (account Account) Play(transaction Transaction, operations []Operation) (Pl
 			Sequence:       playedAccount.LastPlayedSequence,
 			RunningBalance: playedAccount.RunningBalance,
 			RunningHeld:    playedAccount.RunningHeld,
+			SchemaVersion:  eventSchemaVersion,
 		}
 		playedEvents[i] = event
 	}
@@ -129,6 +224,69 @@ func (account Account) Play(transaction Transaction, operations []Operation) (Pl
 	}, nil
 }
 
+// releaseFromHold takes the amount out of the oldest of the holds
+// with enough left to cover it, or reports false when none has.
+func releaseFromHold(holds []int64, amount int64) bool {
+	for i := range holds {
+		if holds[i] >= amount {
+			holds[i] -= amount
+			return true
+		}
+	}
+
+	return false
+}
+
+// OutstandingHolds replays the HOLD and RELEASE operations of a
+// transaction, ordered by sequence, returning what each hold has
+// left oldest first. SETTLE operations release what they settle.
+// releases are taken from a single hold where
+// one covers them, and otherwise netted against the oldest holds
+// first, as they may have been played before the tenant released
+// specific holds.
+func OutstandingHolds(operations []Operation) []int64 {
+	holds := []int64{}
+	for i := range operations {
+		switch operations[i].OperationType {
+		case "HOLD":
+			holds = append(holds, operations[i].AmountInCents)
+		case "RELEASE", "SETTLE":
+			released := operations[i].AmountInCents
+			if releaseFromHold(holds, released) {
+				continue
+			}
+			for j := 0; released > 0 && j < len(holds); j++ {
+				if holds[j] > released {
+					holds[j] -= released
+					break
+				}
+				released -= holds[j]
+				holds[j] = 0
+			}
+		}
+	}
+
+	return holds
+}
+
+// addInt64 returns a+b, or false if the sum doesn't fit in an int64.
+func addInt64(a int64, b int64) (int64, bool) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, false
+	}
+
+	return a + b, true
+}
+
+// subtractInt64 returns a-b, or false if the difference doesn't fit in an int64.
+func subtractInt64(a int64, b int64) (int64, bool) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, false
+	}
+
+	return a - b, true
+}
+
 type Transaction struct {
 	TransactionPK         uint64 `json:"transaction_pk,omitempty"`
 	TransactionID         uint64 `json:"transaction_id"`
@@ -148,8 +306,19 @@ type Operation struct {
 	OperationType string `json:"operation_type"`
 	AmountInCents int64  `json:"amount_in_cents"`
 	Sequence      int64  `json:"sequence"`
+	// orders operations across all of the tenant's transactions,
+	// only assigned for tenants with TenantSequence enabled
+	TenantSequence int64 `json:"tenant_sequence,omitempty"`
+	// free-form context recorded alongside
+	// operations the server generates itself
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// set on fees charged by the server, see operationsWithFees
+	fee bool
 }
 
+// OperationTypes are the operation types accepted over the API.
+var OperationTypes = []string{"HOLD", "RELEASE", "DEBIT", "CREDIT", "SETTLE"}
+
 func (o Operation) Type() (TxOp, error) {
 	switch o.OperationType {
 	case "HOLD":
@@ -160,19 +329,94 @@ func (o Operation) Type() (TxOp, error) {
 		return Debit, nil
 	case "CREDIT":
 		return Credit, nil
+	case "SETTLE":
+		return Settle, nil
 	default:
-		return 0, fmt.Errorf("unknown operation type")
+		return 0, ErrUnknownOperationType
 	}
 }
 
 type Event struct {
-	EventPK        uint64 `json:"event_pk"`
-	EventID        uint64 `json:"event_id"`
-	Tenant         string `json:"tenant"`
-	AccountID      uint64 `json:"account_id"`
-	TransactionID  uint64 `json:"transaction_id"`
-	OperationID    uint64 `json:"operation_id"`
-	RunningBalance int64  `json:"running_balance"`
-	RunningHeld    int64  `json:"running_held"`
-	Sequence       int64  `json:"sequence"`
+	EventPK        uint64    `json:"event_pk"`
+	EventID        uint64    `json:"event_id"`
+	Tenant         string    `json:"tenant"`
+	AccountID      uint64    `json:"account_id"`
+	TransactionID  uint64    `json:"transaction_id"`
+	OperationID    uint64    `json:"operation_id"`
+	RunningBalance int64     `json:"running_balance"`
+	RunningHeld    int64     `json:"running_held"`
+	Sequence       int64     `json:"sequence"`
+	Created        time.Time `json:"created"`
+	// see eventSchemaVersion
+	SchemaVersion int `json:"schema_version"`
+}
+
+// eventSchemaVersion is the version of the Event schema events are
+// played with, recorded with each of them so consumers can tell
+// events apart across changes to it. events recorded before it was
+// introduced are version 1.
+const eventSchemaVersion = 1
+
+// TenantPosition is what a tenant's transactions contribute to an
+// account. holds are taken out of the balance until released, so the
+// balances of all of an account's tenants add up to its RunningBalance.
+type TenantPosition struct {
+	Tenant                string `json:"tenant"`
+	CreditedAmountInCents int64  `json:"credited_amount_in_cents"`
+	DebitedAmountInCents  int64  `json:"debited_amount_in_cents"`
+	HeldAmountInCents     int64  `json:"held_amount_in_cents"`
+	BalanceInCents        int64  `json:"balance_in_cents"`
+}
+
+type HeldOperation struct {
+	Operation
+	HeldAmountInCents int64 `json:"held_amount_in_cents"`
+}
+
+// NetHeldOperations attributes what's still held to the HOLD
+// operations responsible for it. a RELEASE or SETTLE doesn't
+// reference the hold it releases, so releases are netted against
+// the oldest outstanding holds of their transaction first. the
+// operations must be ordered by transaction and then by sequence,
+// and the returned held amounts sum to the held amounts of the
+// transactions.
+func NetHeldOperations(operations []Operation) []HeldOperation {
+	heldOperations := []HeldOperation{}
+	// index into heldOperations of the oldest hold of the
+	// current transaction that hasn't been fully released
+	oldest := 0
+	for i := range operations {
+		if i > 0 && operations[i].TransactionID != operations[i-1].TransactionID {
+			// only holds of the current transaction can be released
+			oldest = len(heldOperations)
+		}
+
+		switch operations[i].OperationType {
+		case "HOLD":
+			heldOperations = append(heldOperations, HeldOperation{
+				Operation:         operations[i],
+				HeldAmountInCents: operations[i].AmountInCents,
+			})
+		case "RELEASE", "SETTLE":
+			released := operations[i].AmountInCents
+			for released > 0 && oldest < len(heldOperations) {
+				if heldOperations[oldest].HeldAmountInCents > released {
+					heldOperations[oldest].HeldAmountInCents -= released
+					break
+				}
+				released -= heldOperations[oldest].HeldAmountInCents
+				heldOperations[oldest].HeldAmountInCents = 0
+				oldest++
+			}
+		}
+	}
+
+	netHeldOperations := []HeldOperation{}
+	for i := range heldOperations {
+		if heldOperations[i].HeldAmountInCents > 0 {
+			netHeldOperations = append(netHeldOperations, heldOperations[i])
+		}
+	}
+
+	return netHeldOperations
 }
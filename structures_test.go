@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNetHeldOperations(t *testing.T) {
+	// played transaction by transaction, as they would be by requests
+	transactions := [][]Operation{
+		{{OperationType: "CREDIT", AmountInCents: 1000}},
+		{{OperationType: "HOLD", AmountInCents: 100}, {OperationType: "HOLD", AmountInCents: 50}, {OperationType: "RELEASE", AmountInCents: 120}},
+		{{OperationType: "HOLD", AmountInCents: 40}, {OperationType: "SETTLE", AmountInCents: 15}},
+		{{OperationType: "HOLD", AmountInCents: 70}, {OperationType: "RELEASE", AmountInCents: 70}},
+		{{OperationType: "HOLD", AmountInCents: 5}},
+	}
+
+	account := Account{AccountID: 1}
+	var operations []Operation
+	for i := range transactions {
+		outcome, err := account.Play(Transaction{AccountID: 1, TransactionID: uint64(i) + 1}, transactions[i])
+		if err != nil {
+			t.Fatalf("unexpected error playing transaction %d: %s", i+1, err)
+		}
+		account = outcome.PlayedAccount
+		for j := range outcome.PlayedOperations {
+			outcome.PlayedOperations[j].TransactionID = uint64(i) + 1
+		}
+		operations = append(operations, outcome.PlayedOperations...)
+	}
+
+	heldOperations := NetHeldOperations(operations)
+	expected := []struct {
+		transactionID uint64
+		held          int64
+	}{
+		{2, 30},
+		{3, 25},
+		{5, 5},
+	}
+	if len(heldOperations) != len(expected) {
+		t.Fatalf("expected %d held operations, got %+v", len(expected), heldOperations)
+	}
+	sum := int64(0)
+	for i := range heldOperations {
+		if heldOperations[i].TransactionID != expected[i].transactionID || heldOperations[i].HeldAmountInCents != expected[i].held {
+			t.Errorf("expected %d held by transaction %d, got %d held by transaction %d", expected[i].held, expected[i].transactionID, heldOperations[i].HeldAmountInCents, heldOperations[i].TransactionID)
+		}
+		sum += heldOperations[i].HeldAmountInCents
+	}
+	if sum != account.RunningHeld {
+		t.Errorf("expected the held operations to sum to the account's running held %d, got %d", account.RunningHeld, sum)
+	}
+}
+
+func TestNetHeldOperationsReleasesStayInTheirTransaction(t *testing.T) {
+	operations := []Operation{
+		{TransactionID: 1, OperationType: "HOLD", AmountInCents: 10},
+		{TransactionID: 2, OperationType: "HOLD", AmountInCents: 10},
+		{TransactionID: 2, OperationType: "RELEASE", AmountInCents: 10},
+	}
+
+	heldOperations := NetHeldOperations(operations)
+	if len(heldOperations) != 1 || heldOperations[0].TransactionID != 1 || heldOperations[0].HeldAmountInCents != 10 {
+		t.Errorf("expected only transaction 1's hold to be left, got %+v", heldOperations)
+	}
+}
+
+func TestPlayAmountOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		account     Account
+		transaction Transaction
+		operations  []Operation
+		wantErr     error
+	}{
+		{
+			name:       "credit up to MaxInt64",
+			account:    Account{RunningBalance: math.MaxInt64 - 1},
+			operations: []Operation{{OperationType: "CREDIT", AmountInCents: 1}},
+		},
+		{
+			name:       "credit past MaxInt64",
+			account:    Account{RunningBalance: math.MaxInt64 - 1},
+			operations: []Operation{{OperationType: "CREDIT", AmountInCents: 2}},
+			wantErr:    ErrAmountOverflow,
+		},
+		{
+			name:        "transaction credited past MaxInt64",
+			transaction: Transaction{CreditedAmountInCents: math.MaxInt64},
+			operations:  []Operation{{OperationType: "CREDIT", AmountInCents: 1}},
+			wantErr:     ErrAmountOverflow,
+		},
+		{
+			name:        "transaction debited past MaxInt64",
+			account:     Account{RunningBalance: 10},
+			transaction: Transaction{DebitedAmountInCents: math.MaxInt64},
+			operations:  []Operation{{OperationType: "DEBIT", AmountInCents: 1}},
+			wantErr:     ErrAmountOverflow,
+		},
+		{
+			name:        "held past MaxInt64",
+			account:     Account{RunningBalance: 10, RunningHeld: math.MaxInt64},
+			transaction: Transaction{HeldAmountInCents: math.MaxInt64},
+			operations:  []Operation{{OperationType: "HOLD", AmountInCents: 1}},
+			wantErr:     ErrAmountOverflow,
+		},
+		{
+			name:       "later operation overflows",
+			account:    Account{RunningBalance: math.MaxInt64 - 10},
+			operations: []Operation{{OperationType: "CREDIT", AmountInCents: 10}, {OperationType: "CREDIT", AmountInCents: 1}},
+			wantErr:    ErrAmountOverflow,
+		},
+		{
+			name:       "debit of MaxInt64 with an overdraft",
+			account:    Account{RunningBalance: -2, OverdraftLimitInCents: math.MaxInt64},
+			operations: []Operation{{OperationType: "DEBIT", AmountInCents: math.MaxInt64}},
+			wantErr:    ErrAmountOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, err := tt.account.Play(tt.transaction, tt.operations)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil && len(outcome.PlayedOperations) != 0 {
+				t.Errorf("expected nothing played, got %d operations", len(outcome.PlayedOperations))
+			}
+		})
+	}
+}
+
+func TestPlayReleaseSpecificHolds(t *testing.T) {
+	tests := []struct {
+		name             string
+		outstandingHolds []int64
+		operations       []Operation
+		aggregateErr     error
+		specificErr      error
+	}{
+		{
+			name:       "release covered by one hold",
+			operations: []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 30}},
+		},
+		{
+			name:        "release only covered by the holds together",
+			operations:  []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 40}},
+			specificErr: ErrReleaseExceedsHold,
+		},
+		{
+			name:        "settle only covered by the holds together",
+			operations:  []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "SETTLE", AmountInCents: 40}},
+			specificErr: ErrReleaseExceedsHold,
+		},
+		{
+			name:        "holds already partly released",
+			operations:  []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "RELEASE", AmountInCents: 20}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 10}},
+			specificErr: nil,
+		},
+		{
+			name:             "outstanding holds from earlier requests",
+			outstandingHolds: []int64{10, 25},
+			operations:       []Operation{{OperationType: "RELEASE", AmountInCents: 25}},
+		},
+		{
+			name:             "outstanding holds too small for the release",
+			outstandingHolds: []int64{10, 25},
+			operations:       []Operation{{OperationType: "RELEASE", AmountInCents: 30}},
+			specificErr:      ErrReleaseExceedsHold,
+		},
+		{
+			name:         "release exceeding everything held",
+			operations:   []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "RELEASE", AmountInCents: 31}},
+			aggregateErr: ErrInvalidPlayOrderNegativeHold,
+			specificErr:  ErrInvalidPlayOrderNegativeHold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			held := int64(0)
+			for i := range tt.outstandingHolds {
+				held += tt.outstandingHolds[i]
+			}
+			account := Account{AccountID: 1, RunningBalance: 100, RunningHeld: held}
+			transaction := Transaction{AccountID: 1, HeldAmountInCents: held}
+			outstandingHolds := append([]int64(nil), tt.outstandingHolds...)
+
+			_, err := account.PlayWithOptions(transaction, tt.operations, PlayOptions{OutstandingHolds: outstandingHolds})
+			if !errors.Is(err, tt.aggregateErr) {
+				t.Errorf("aggregate: expected error %v, got %v", tt.aggregateErr, err)
+			}
+			_, err = account.PlayWithOptions(transaction, tt.operations, PlayOptions{ReleaseSpecificHolds: true, OutstandingHolds: outstandingHolds})
+			if !errors.Is(err, tt.specificErr) {
+				t.Errorf("per hold: expected error %v, got %v", tt.specificErr, err)
+			}
+			for i := range outstandingHolds {
+				if outstandingHolds[i] != tt.outstandingHolds[i] {
+					t.Fatalf("expected the caller's outstanding holds to be left as they were, got %v", outstandingHolds)
+				}
+			}
+		})
+	}
+}
+
+func TestOutstandingHolds(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []Operation
+		expected   []int64
+	}{
+		{name: "no operations", operations: nil, expected: []int64{}},
+		{name: "holds only", operations: []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "HOLD", AmountInCents: 20}}, expected: []int64{30, 20}},
+		{name: "release from the first hold covering it", operations: []Operation{{OperationType: "HOLD", AmountInCents: 10}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 15}}, expected: []int64{10, 5}},
+		{name: "settle releases", operations: []Operation{{OperationType: "HOLD", AmountInCents: 30}, {OperationType: "SETTLE", AmountInCents: 10}}, expected: []int64{20}},
+		{name: "release netted oldest first", operations: []Operation{{OperationType: "HOLD", AmountInCents: 10}, {OperationType: "HOLD", AmountInCents: 20}, {OperationType: "RELEASE", AmountInCents: 25}}, expected: []int64{0, 5}},
+		{name: "other operations ignored", operations: []Operation{{OperationType: "CREDIT", AmountInCents: 100}, {OperationType: "HOLD", AmountInCents: 10}, {OperationType: "DEBIT", AmountInCents: 5}}, expected: []int64{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holds := OutstandingHolds(tt.operations)
+			if len(holds) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, holds)
+			}
+			for i := range holds {
+				if holds[i] != tt.expected[i] {
+					t.Fatalf("expected %v, got %v", tt.expected, holds)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayPlayedOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []Operation
+	}{
+		{name: "single operation", operations: []Operation{{OperationType: "CREDIT", AmountInCents: 100}}},
+		{name: "every operation type", operations: []Operation{
+			{OperationType: "CREDIT", AmountInCents: 100},
+			{OperationType: "HOLD", AmountInCents: 50},
+			{OperationType: "SETTLE", AmountInCents: 20},
+			{OperationType: "RELEASE", AmountInCents: 30},
+			{OperationType: "DEBIT", AmountInCents: 10},
+		}},
+		{name: "repeated operations", operations: []Operation{
+			{OperationType: "CREDIT", AmountInCents: 1},
+			{OperationType: "CREDIT", AmountInCents: 1},
+			{OperationType: "CREDIT", AmountInCents: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := Account{AccountID: 1, LastPlayedSequence: 7}
+			transaction := Transaction{AccountID: 1, TransactionID: 2}
+			outcome, err := account.Play(transaction, tt.operations)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(outcome.PlayedOperations) != len(tt.operations) {
+				t.Fatalf("expected %d played operations, got %d", len(tt.operations), len(outcome.PlayedOperations))
+			}
+			if len(outcome.PlayedEvents) != len(tt.operations) {
+				t.Fatalf("expected %d played events, got %d", len(tt.operations), len(outcome.PlayedEvents))
+			}
+			// no trailing zero valued operations or events
+			for i := range outcome.PlayedOperations {
+				if outcome.PlayedOperations[i].Sequence != int64(i)+1 {
+					t.Errorf("expected operation %d to have sequence %d, got %d", i, i+1, outcome.PlayedOperations[i].Sequence)
+				}
+				if outcome.PlayedEvents[i].Sequence != account.LastPlayedSequence+int64(i)+1 {
+					t.Errorf("expected event %d to have sequence %d, got %d", i, account.LastPlayedSequence+int64(i)+1, outcome.PlayedEvents[i].Sequence)
+				}
+			}
+			if outcome.PlayedAccount.LastPlayedSequence != account.LastPlayedSequence+int64(len(tt.operations)) {
+				t.Errorf("expected account sequence %d, got %d", account.LastPlayedSequence+int64(len(tt.operations)), outcome.PlayedAccount.LastPlayedSequence)
+			}
+		})
+	}
+}
+
+func TestPlayUnknownOperationType(t *testing.T) {
+	account := Account{AccountID: 1, RunningBalance: 100}
+	operations := []Operation{
+		{OperationType: "CREDIT", AmountInCents: 100},
+		{OperationType: "REFUND", AmountInCents: 50},
+		{OperationType: "DEBIT", AmountInCents: 10},
+	}
+
+	outcome, err := account.Play(Transaction{AccountID: 1}, operations)
+	if !errors.Is(err, ErrUnknownOperationType) {
+		t.Fatalf("expected ErrUnknownOperationType, got %v", err)
+	}
+	// nothing is played, not even the operations ahead of it
+	if len(outcome.PlayedOperations) != 0 || len(outcome.PlayedEvents) != 0 {
+		t.Errorf("expected nothing played, got %d operations and %d events", len(outcome.PlayedOperations), len(outcome.PlayedEvents))
+	}
+	if outcome.PlayedAccount != (Account{}) {
+		t.Errorf("expected no played account, got %+v", outcome.PlayedAccount)
+	}
+}
+
+func TestPlayOverdraftLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		balance        int64
+		overdraftLimit int64
+		options        PlayOptions
+		operations     []Operation
+		wantErr        error
+	}{
+		{name: "no limit, down to zero", balance: 100, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 100}}},
+		{name: "no limit, below zero", balance: 100, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 101}}, wantErr: ErrInvalidPlayOrderNegativeBalance},
+		{name: "down to the limit", balance: 100, overdraftLimit: 50, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 150}}},
+		{name: "past the limit", balance: 100, overdraftLimit: 50, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 151}}, wantErr: ErrInvalidPlayOrderNegativeBalance},
+		{name: "hold down to the limit", balance: 100, overdraftLimit: 50, operations: []Operation{{OperationType: "HOLD", AmountInCents: 150}}},
+		{name: "hold past the limit", balance: 100, overdraftLimit: 50, operations: []Operation{{OperationType: "HOLD", AmountInCents: 151}}, wantErr: ErrInvalidPlayOrderNegativeBalance},
+		{name: "overdrawn and credited back within the limit", balance: -50, overdraftLimit: 50, operations: []Operation{{OperationType: "CREDIT", AmountInCents: 10}}},
+		{name: "past the limit in between", balance: 0, overdraftLimit: 50, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 51}, {OperationType: "CREDIT", AmountInCents: 51}}, wantErr: ErrInvalidPlayOrderNegativeBalance},
+		{name: "fee past the limit", balance: 0, overdraftLimit: 50, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 50}, {OperationType: "DEBIT", AmountInCents: 1, fee: true}}, wantErr: ErrFeeNegativeBalance},
+		{name: "negative balance allowed", balance: 0, overdraftLimit: 50, options: PlayOptions{AllowNegativeBalance: true}, operations: []Operation{{OperationType: "DEBIT", AmountInCents: 1000}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := Account{AccountID: 1, RunningBalance: tt.balance, OverdraftLimitInCents: tt.overdraftLimit}
+			_, err := account.PlayWithOptions(Transaction{AccountID: 1}, tt.operations, tt.options)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPlaySettle(t *testing.T) {
+	tests := []struct {
+		name            string
+		operations      []Operation
+		wantErr         error
+		balance         int64
+		held            int64
+		transactionHeld int64
+		debited         int64
+	}{
+		{
+			name:            "full settlement",
+			operations:      []Operation{{OperationType: "HOLD", AmountInCents: 60}, {OperationType: "SETTLE", AmountInCents: 60}},
+			balance:         40,
+			held:            0,
+			transactionHeld: 0,
+			debited:         60,
+		},
+		{
+			name:            "partial settlement",
+			operations:      []Operation{{OperationType: "HOLD", AmountInCents: 60}, {OperationType: "SETTLE", AmountInCents: 25}},
+			balance:         40,
+			held:            35,
+			transactionHeld: 35,
+			debited:         25,
+		},
+		{
+			name:            "partial settlement then release of the rest",
+			operations:      []Operation{{OperationType: "HOLD", AmountInCents: 60}, {OperationType: "SETTLE", AmountInCents: 25}, {OperationType: "RELEASE", AmountInCents: 35}},
+			balance:         75,
+			held:            0,
+			transactionHeld: 0,
+			debited:         25,
+		},
+		{
+			name:            "settlements adding up to the hold",
+			operations:      []Operation{{OperationType: "HOLD", AmountInCents: 60}, {OperationType: "SETTLE", AmountInCents: 25}, {OperationType: "SETTLE", AmountInCents: 35}},
+			balance:         40,
+			held:            0,
+			transactionHeld: 0,
+			debited:         60,
+		},
+		{
+			name:       "settling more than is held",
+			operations: []Operation{{OperationType: "HOLD", AmountInCents: 60}, {OperationType: "SETTLE", AmountInCents: 61}},
+			wantErr:    ErrInvalidPlayOrderNegativeHold,
+		},
+		{
+			name:       "settling without a hold",
+			operations: []Operation{{OperationType: "SETTLE", AmountInCents: 1}},
+			wantErr:    ErrInvalidPlayOrderNegativeHold,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := Account{AccountID: 1, RunningBalance: 100}
+			outcome, err := account.Play(Transaction{AccountID: 1}, tt.operations)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if outcome.PlayedAccount.RunningBalance != tt.balance {
+				t.Errorf("expected balance %d, got %d", tt.balance, outcome.PlayedAccount.RunningBalance)
+			}
+			if outcome.PlayedAccount.RunningHeld != tt.held {
+				t.Errorf("expected account held %d, got %d", tt.held, outcome.PlayedAccount.RunningHeld)
+			}
+			if outcome.PlayedTransaction.HeldAmountInCents != tt.transactionHeld {
+				t.Errorf("expected transaction held %d, got %d", tt.transactionHeld, outcome.PlayedTransaction.HeldAmountInCents)
+			}
+			if outcome.PlayedTransaction.DebitedAmountInCents != tt.debited {
+				t.Errorf("expected transaction debited %d, got %d", tt.debited, outcome.PlayedTransaction.DebitedAmountInCents)
+			}
+		})
+	}
+}
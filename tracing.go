@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// until a provider is set, the global one hands out spans
+// that record nothing, so tracing is a no-op unless enabled.
+var tracer = otel.Tracer("github.com/s-rangarajan/affount")
+
+// MustSetupTracing exports spans over OTLP/HTTP to the endpoint,
+// returning the provider to be shut down before exiting, or nil
+// when there's no endpoint and tracing stays a no-op. the exporter
+// itself picks the rest of its config from the standard OTEL_ env.
+func MustSetupTracing(endpoint string) *sdktrace.TracerProvider {
+	if endpoint == "" {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("affount"),
+			semconv.ServiceVersionKey.String(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider
+}
+
+// traceHandler starts the root span of a request, named
+// after the endpoint and ended once the handler returns.
+func traceHandler(endpoint string, w *statusRecorder, r *http.Request, next http.HandlerFunc) {
+	ctx, span := tracer.Start(r.Context(), endpoint, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	next(w, r.WithContext(ctx))
+
+	span.SetAttributes(attribute.Int("http.status_code", w.statusCode))
+	if w.statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(w.statusCode))
+	}
+}
+
+// tracedContext carries the request's span over to ctx, handlers
+// derive their contexts from the server's rather than the request's.
+func tracedContext(ctx context.Context, r *http.Request) context.Context {
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(r.Context()))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+)
+
+// events are flushed to the client in batches of this many
+const transactionHistoryFlushEvery = 100
+
+// HandleTransactionHistoryWithContext streams the events of a transaction
+// as NDJSON, in the order they were played, written as they're read so
+// histories of any length are never held in memory. after_sequence resumes
+// a history cut short from the last event received. the client going away
+// stops the query. once streaming has started errors can't change the
+// status, the history just ends early, without the {"complete":true}
+// record that otherwise ends it.
+func HandleTransactionHistoryWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received transaction history request")
+	transactionID, err := strconv.ParseUint(r.URL.Query().Get("transaction_id"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing/invalid transaction_id parameter"))
+		return
+	}
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		writeHTTPError(w, http.StatusBadRequest, errors.New("error missing tenant parameter"))
+		return
+	}
+	var afterSequence int64
+	if value := r.URL.Query().Get("after_sequence"); value != "" {
+		afterSequence, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || afterSequence < 0 {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("error invalid after_sequence parameter"))
+			return
+		}
+	}
+
+	ctx, cancel := cancelWhenClientGone(ctx, r)
+	defer cancel()
+
+	logger.Infow("handling transaction history request", "transaction_id", transactionID, "tenant", tenant, "after_sequence", afterSequence)
+	tx, err := pool.BeginTx(ctx, readOnlyTxOptions)
+	if err != nil {
+		logger.Errorf("error beginning transaction history transaction: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error beginning transaction: %w", err))
+		debug.PrintStack()
+		return
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	transaction, err := GetTransactionWithContext(ctx, tx, tenant, transactionID)
+	if errors.Is(err, ErrNotFound) {
+		writeHTTPError(w, http.StatusNotFound, errors.New("error transaction not found"))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing transaction history database operations: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	streamed := 0
+	err = StreamTransactionEventsWithContext(ctx, tx, transaction, afterSequence, func(event Event) error {
+		extendWriteDeadline(r)
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+		streamed++
+		if flusher != nil && streamed%transactionHistoryFlushEvery == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+	if err == nil {
+		extendWriteDeadline(r)
+		err = encoder.Encode(streamEndRecord{Complete: true})
+	}
+	if err != nil {
+		logger.Errorw("transaction history ended early", "transaction_id", transactionID, "tenant", tenant, "after_sequence", afterSequence, "events", streamed, "error", err.Error())
+		return
+	}
+	logger.Infow("transaction history streamed", "transaction_id", transactionID, "tenant", tenant, "after_sequence", afterSequence, "events", streamed)
+}
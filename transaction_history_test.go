@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHandleTransactionHistoryEndsWithCompleteRecord(t *testing.T) {
+	pool := testPool(t)
+	account := testAccount(t, pool)
+	played := testPlay(t, pool, account.AccountID, op("CREDIT", 100), op("DEBIT", 40))
+
+	target := fmt.Sprintf("/transaction_history?transaction_id=%d&tenant=%s", played.Transaction.TransactionID, testTenant)
+	w := testRequest(t, HandleTransactionHistoryWithContext, pool, http.MethodGet, target, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("expected 2 events and the end record, got %d lines: %s", len(lines), w.Body.String())
+	}
+	var end streamEndRecord
+	if err := json.Unmarshal(lines[len(lines)-1], &end); err != nil || !end.Complete {
+		t.Errorf("expected the stream to end with a complete record, got %s", lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+type transferHoldRequest struct {
+	Tenant                   string `json:"tenant"`
+	SourceTransactionID      uint64 `json:"source_transaction_id"`
+	DestinationTransactionID uint64 `json:"destination_transaction_id"`
+	AmountInCents            int64  `json:"amount_in_cents"`
+}
+
+type transferHoldResponse struct {
+	Account                Account     `json:"account"`
+	SourceTransaction      Transaction `json:"source_transaction"`
+	DestinationTransaction Transaction `json:"destination_transaction"`
+	// the RELEASE played on the source and the HOLD on the destination
+	Operations []Operation `json:"operations"`
+}
+
+// HandleTransferHoldWithContext moves held funds from one of an account's
+// transactions to another, e.g. reallocating an authorization, by playing
+// a RELEASE on the source and a HOLD of the same amount on the destination
+// under a single account lock. the account's balance and held amount end
+// where they started, only which transaction holds the funds changes.
+func HandleTransferHoldWithContext(ctx context.Context, pool *sql.DB, w http.ResponseWriter, r *http.Request) {
+	defer logger.Sync()
+	logger.Info("received transfer hold request")
+	if r.Body == nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error empty request body"))
+		return
+	}
+
+	var req transferHoldRequest
+	if err := decodeRequestBody(r.Body, &req); err != nil {
+		writeHTTPError(w, decodeErrorStatus(err), fmt.Errorf("error decoding request body: %w", err))
+		return
+	}
+
+	if req.Tenant == "" || req.SourceTransactionID == 0 || req.DestinationTransactionID == 0 || req.AmountInCents <= 0 {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error missing required fields"))
+		return
+	}
+	if req.SourceTransactionID == req.DestinationTransactionID {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error source and destination transactions must differ"))
+		return
+	}
+	if !config.IsTenantAllowed(req.Tenant) {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("error tenant not allowed"))
+		return
+	}
+	if !config.TenantConfig(req.Tenant).HoldTransfers {
+		writeHTTPError(w, http.StatusForbidden, fmt.Errorf("error hold transfers are disabled for the tenant"))
+		return
+	}
+
+	logger.Infow("handling transfer hold request", "request", redacted(req))
+	// the account is only known once the transaction is read,
+	// and the gate is held across attempts rather than per attempt
+	var gatedAccountID uint64
+	defer func() {
+		if gatedAccountID != 0 {
+			accountGate.Release(gatedAccountID)
+		}
+	}()
+
+	var result transferHoldResponse
+	err := withRetryableTx(ctx, pool, config.PlayTxOptions(), func(tx *sql.Tx) error {
+		source, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.SourceTransactionID)
+		if errors.Is(err, ErrNotFound) {
+			return earlyHTTPError(http.StatusNotFound, errors.New("error source transaction not found"))
+		}
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+
+		if gatedAccountID == 0 {
+			if !accountGate.TryAcquire(source.AccountID) {
+				early := earlyHTTPError(http.StatusTooManyRequests, fmt.Errorf("error too many concurrent requests for account"))
+				early.retryAfter = config.ConcurrencyRetryAfter
+				return early
+			}
+			gatedAccountID = source.AccountID
+		}
+
+		account, err := LockAccountWithContext(ctx, tx, source.AccountID)
+		if err != nil {
+			return fmt.Errorf("error locking account: %w", err)
+		}
+
+		// read again under the account lock, holds may
+		// have been added or released in the meantime
+		source, err = GetTransactionWithContext(ctx, tx, req.Tenant, req.SourceTransactionID)
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+		destination, err := GetTransactionWithContext(ctx, tx, req.Tenant, req.DestinationTransactionID)
+		if errors.Is(err, ErrNotFound) {
+			return earlyHTTPError(http.StatusNotFound, errors.New("error destination transaction not found"))
+		}
+		if err != nil {
+			return fmt.Errorf("error getting transaction: %w", err)
+		}
+		if destination.AccountID != source.AccountID {
+			return earlyHTTPError(config.BusinessRejectionStatus, ErrTransactionAccountMismatch)
+		}
+		if source.HeldAmountInCents < req.AmountInCents {
+			return earlyHTTPError(config.BusinessRejectionStatus, fmt.Errorf("error source transaction holds %d cents, less than the amount", source.HeldAmountInCents))
+		}
+
+		released, err := processExistingTransaction(ctx, tx, []Operation{{OperationType: "RELEASE", AmountInCents: req.AmountInCents}}, account, source)
+		if err != nil {
+			return transferHoldError(err)
+		}
+		held, err := processExistingTransaction(ctx, tx, []Operation{{OperationType: "HOLD", AmountInCents: req.AmountInCents}}, released.Account, destination)
+		if err != nil {
+			return transferHoldError(err)
+		}
+
+		result = transferHoldResponse{
+			Account:                held.Account,
+			SourceTransaction:      released.Transaction,
+			DestinationTransaction: held.Transaction,
+			Operations:             append(released.Operations, held.Operations...),
+		}
+
+		return nil
+	})
+	var early earlyResponse
+	if errors.As(err, &early) {
+		writeEarlyResponse(w, early)
+		return
+	}
+	if isRetryableTxError(err) {
+		logger.Warnw("giving up on transaction failing to serialize", "request", redacted(req), "error", err.Error())
+		writeRetryableHTTPError(w, http.StatusServiceUnavailable, config.UnavailableRetryAfter, fmt.Errorf("error executing database operations: %w", err))
+		return
+	}
+	if err != nil {
+		logger.Errorf("error executing transfer hold request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error executing database operations: %w", err))
+		debug.PrintStack()
+		return
+	}
+	logger.Infow("hold transferred", "request", redacted(req), "result", redacted(result))
+
+	marshaledData, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("error marshaling response for transfer hold request: %s", err.Error())
+		writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("error marshaling response: %w", err))
+		debug.PrintStack()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(marshaledData)
+}
+
+// transferHoldError maps an error playing either side of a
+// transfer to the response the whole transfer is rejected with.
+func transferHoldError(err error) error {
+	switch {
+	case errors.Is(err, ErrTransactionClosed):
+		return earlyHTTPError(http.StatusConflict, ErrTransactionClosed)
+	case errors.Is(err, ErrAccountClosed):
+		return earlyHTTPError(http.StatusConflict, ErrAccountClosed)
+	case errors.Is(err, ErrInvalidPlayOrderNegativeHold), errors.Is(err, ErrAmountOverflow), errors.Is(err, ErrTooManyActiveHolds), errors.Is(err, ErrTransactionOperationLimit):
+		return earlyHTTPError(config.BusinessRejectionStatus, err)
+	default:
+		return fmt.Errorf("error processing operations: %w", err)
+	}
+}
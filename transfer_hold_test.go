@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandleTransferHoldConservesHeld(t *testing.T) {
+	defer func(tenantConfigs map[string]TenantConfig) {
+		config.TenantConfigs = tenantConfigs
+	}(config.TenantConfigs)
+	config.TenantConfigs = map[string]TenantConfig{testTenant: {HoldTransfers: true}}
+	pool := testPool(t)
+
+	tests := []struct {
+		name                    string
+		amount                  int64
+		statusCode              int
+		expectedSourceHeld      int64
+		expectedDestinationHeld int64
+	}{
+		{name: "part of the hold", amount: 200, statusCode: http.StatusOK, expectedSourceHeld: 100, expectedDestinationHeld: 250},
+		{name: "all of the hold", amount: 300, statusCode: http.StatusOK, expectedSourceHeld: 0, expectedDestinationHeld: 350},
+		{name: "more than the hold", amount: 301, statusCode: config.BusinessRejectionStatus, expectedSourceHeld: 300, expectedDestinationHeld: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testAccount(t, pool)
+			testPlay(t, pool, account.AccountID, op("CREDIT", 1000))
+			source := testPlay(t, pool, account.AccountID, op("HOLD", 300))
+			destination := testPlay(t, pool, account.AccountID, op("HOLD", 50))
+			before := testGetAccount(t, pool, account.AccountID)
+
+			w := testRequest(t, HandleTransferHoldWithContext, pool, http.MethodPost, "/transfer_hold", transferHoldRequest{
+				Tenant:                   testTenant,
+				SourceTransactionID:      source.Transaction.TransactionID,
+				DestinationTransactionID: destination.Transaction.TransactionID,
+				AmountInCents:            tt.amount,
+			})
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+
+			// whether it moved or not, the account holds what it did
+			after := testGetAccount(t, pool, account.AccountID)
+			if after.RunningHeld != before.RunningHeld || after.RunningBalance != before.RunningBalance {
+				t.Errorf("expected held %d and balance %d conserved, got %d and %d", before.RunningHeld, before.RunningBalance, after.RunningHeld, after.RunningBalance)
+			}
+			if tt.statusCode != http.StatusOK {
+				if after.LastPlayedSequence != before.LastPlayedSequence {
+					t.Errorf("expected nothing played, got sequence %d from %d", after.LastPlayedSequence, before.LastPlayedSequence)
+				}
+				return
+			}
+
+			var res transferHoldResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("error unmarshaling response: %s", err)
+			}
+			if res.SourceTransaction.HeldAmountInCents != tt.expectedSourceHeld || res.DestinationTransaction.HeldAmountInCents != tt.expectedDestinationHeld {
+				t.Errorf("expected %d held on the source and %d on the destination, got %d and %d", tt.expectedSourceHeld, tt.expectedDestinationHeld, res.SourceTransaction.HeldAmountInCents, res.DestinationTransaction.HeldAmountInCents)
+			}
+			if res.Account.RunningHeld != after.RunningHeld {
+				t.Errorf("expected the committed held %d, got %d", after.RunningHeld, res.Account.RunningHeld)
+			}
+			if len(res.Operations) != 2 || res.Operations[0].OperationType != "RELEASE" || res.Operations[1].OperationType != "HOLD" {
+				t.Errorf("expected a RELEASE and a HOLD played, got %+v", res.Operations)
+			}
+		})
+	}
+}
+
+func TestHandleTransferHoldDisabled(t *testing.T) {
+	// rejected before the pool is used
+	w := testRequest(t, HandleTransferHoldWithContext, nil, http.MethodPost, "/transfer_hold", transferHoldRequest{
+		Tenant:                   testTenant,
+		SourceTransactionID:      1,
+		DestinationTransactionID: 2,
+		AmountInCents:            100,
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d: %s", w.Code, w.Body.String())
+	}
+}